@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	libjson "encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/format/json"
+)
+
+// entry is a parsed log line
+type entry struct {
+	// line is the entry written by format/json
+	line    string
+	context interface{}
+	message string
+	level   level.Level
+	time    time.Time
+}
+
+// parseEntry parses a line written by format/json
+func parseEntry(line string) (entry, error) {
+	decoded, err := json.DecodeLine([]byte(line), nil)
+	if err != nil {
+		return entry{}, err
+	}
+
+	return newEntry(line, decoded.Context, decoded.Message), nil
+}
+
+// newEntry returns the entry of a line written by format/json,
+// with the level and time read from the context
+func newEntry(line string, context interface{}, message string) entry {
+	e := entry{
+		line:    line,
+		context: context,
+		message: message,
+	}
+
+	if s, ok := e.field("level"); ok {
+		e.level, _ = level.NewLevelFromString(s)
+	}
+	if s, ok := e.field("time"); ok {
+		e.time, _ = time.Parse(time.RFC3339Nano, s)
+	}
+	return e
+}
+
+// lookup returns the value of the context field at the dotted path
+func (e entry) lookup(path string) (interface{}, bool) {
+	v := e.context
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// field returns the context field at the dotted path as a string
+func (e entry) field(path string) (string, bool) {
+	v, ok := e.lookup(path)
+	if !ok {
+		return "", false
+	}
+	return valueString(v), true
+}
+
+// valueString returns strings unquoted and other values as JSON
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case libjson.Number:
+		return v.String()
+	case nil:
+		return "null"
+	}
+
+	buf := bytes.Buffer{}
+	enc := libjson.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// operators are ordered so that the two characters ones match first
+var operators = []string{"!=", "!~", ">=", "<=", "=", "~", ">", "<"}
+
+// expression compares a context field to a value
+type expression struct {
+	key   string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func parseExpression(s string) (expression, error) {
+	i := strings.IndexAny(s, "=!~<>")
+	if i <= 0 {
+		return expression{}, fmt.Errorf("%s: want key, operator and value", s)
+	}
+
+	for _, op := range operators {
+		if !strings.HasPrefix(s[i:], op) {
+			continue
+		}
+
+		e := expression{
+			key:   s[:i],
+			op:    op,
+			value: s[i+len(op):],
+		}
+		if op == "~" || op == "!~" {
+			re, err := regexp.Compile(e.value)
+			if err != nil {
+				return expression{}, err
+			}
+			e.re = re
+		}
+		return e, nil
+	}
+	return expression{}, fmt.Errorf("%s: unknown operator", s)
+}
+
+func (e expression) String() string {
+	return e.key + e.op + e.value
+}
+
+// match returns true if the field of entry matches.
+// A missing field only matches != and !~.
+func (e expression) match(entry entry) bool {
+	v, ok := entry.field(e.key)
+
+	switch e.op {
+	case "=":
+		return ok && v == e.value
+	case "!=":
+		return !ok || v != e.value
+	case "~":
+		return ok && e.re.MatchString(v)
+	case "!~":
+		return !ok || !e.re.MatchString(v)
+	}
+
+	if !ok {
+		return false
+	}
+
+	n := compare(v, e.value)
+	switch e.op {
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	}
+	return n <= 0
+}
+
+// compare compares a and b as numbers, times or strings
+func compare(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if x, err := time.Parse(time.RFC3339Nano, a); err == nil {
+		if y, err := time.Parse(time.RFC3339Nano, b); err == nil {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// filter selects entries
+type filter struct {
+	level level.Level
+	since time.Time
+	until time.Time
+	grep  *regexp.Regexp
+	where []expression
+}
+
+func (f filter) empty() bool {
+	return f.level == level.UNSET && f.since.IsZero() && f.until.IsZero() &&
+		f.grep == nil && len(f.where) == 0
+}
+
+func (f filter) match(e entry) bool {
+	if f.level != level.UNSET && !level.IsActive(f.level, e.level) {
+		return false
+	}
+
+	if !f.since.IsZero() || !f.until.IsZero() {
+		if e.time.IsZero() {
+			return false
+		}
+		if !f.since.IsZero() && e.time.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && !e.time.Before(f.until) {
+			return false
+		}
+	}
+
+	if f.grep != nil && !f.grep.MatchString(e.message) {
+		return false
+	}
+
+	for _, expr := range f.where {
+		if !expr.match(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/6prod/genelog/field/level"
+)
+
+// encoder returns an entry as one line
+type encoder func(e entry, colored bool) string
+
+var encoders = map[string]encoder{
+	"console": encodeConsole,
+	"json":    encodeJSON,
+	"logfmt":  encodeLogfmt,
+}
+
+var levelColors = map[level.Level]*color.Color{
+	level.DEBUG:   level.DebugColor,
+	level.INFO:    level.InfoColor,
+	level.WARNING: level.WarningColor,
+	level.ERROR:   level.ErrorColor,
+	level.FATAL:   level.FatalColor,
+}
+
+// keyColor colors the keys of the fields
+var keyColor = color.New(color.Faint)
+
+// field is a flattened context field
+type field struct {
+	key   string
+	value string
+}
+
+// fields returns the context fields but the level and time,
+// nested objects flattened into dotted keys
+func fields(e entry) []field {
+	fields := make([]field, 0)
+
+	m, ok := e.context.(map[string]interface{})
+	if !ok {
+		if e.context != nil {
+			fields = append(fields, field{"context", valueString(e.context)})
+		}
+		return fields
+	}
+
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			key := prefix + k
+			if prefix == "" && (k == "level" || k == "time") {
+				continue
+			}
+			if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+				flatten(key+".", sub)
+				continue
+			}
+			fields = append(fields, field{key, valueString(v)})
+		}
+	}
+	flatten("", m)
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].key < fields[j].key
+	})
+	return fields
+}
+
+// quote quotes logfmt values with spaces, quotes or equal signs
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"=\\") || !strconv.CanBackquote(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func encodeJSON(e entry, colored bool) string {
+	return e.line
+}
+
+func encodeLogfmt(e entry, colored bool) string {
+	parts := make([]string, 0)
+	if t, ok := e.field("time"); ok {
+		parts = append(parts, "time="+quote(t))
+	}
+	if e.level != level.UNSET {
+		parts = append(parts, "level="+e.level.String())
+	}
+	parts = append(parts, "msg="+quote(e.message))
+	for _, f := range fields(e) {
+		parts = append(parts, f.key+"="+quote(f.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func encodeConsole(e entry, colored bool) string {
+	parts := make([]string, 0)
+	if t, ok := e.field("time"); ok {
+		parts = append(parts, t)
+	}
+	if e.level != level.UNSET {
+		s := fmt.Sprintf("%-7s", strings.ToUpper(e.level.String()))
+		if c, ok := levelColors[e.level]; ok && colored {
+			s = c.Sprint(s)
+		}
+		parts = append(parts, s)
+	}
+	parts = append(parts, e.message)
+	for _, f := range fields(e) {
+		key := f.key + "="
+		if colored {
+			key = keyColor.Sprint(key)
+		}
+		parts = append(parts, key+quote(f.value))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	libjson "encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/6prod/genelog/format/json"
+)
+
+// decoder parses a line into an entry
+type decoder func(line string) (entry, error)
+
+var decoders = map[string]decoder{
+	"json":   parseEntry,
+	"logfmt": parseLogfmt,
+}
+
+// parseLogfmt parses a logfmt line, like those printed with -o
+// logfmt: the msg key is the message, the dotted keys are nested
+// context fields and the unquoted numbers, booleans and null are
+// JSON values. Lines without msg key are not entries.
+func parseLogfmt(line string) (entry, error) {
+	context := make(map[string]interface{})
+	message, found := "", false
+
+	for rest := strings.TrimSpace(line); rest != ""; rest = strings.TrimLeft(rest, " \t") {
+		var key, value string
+		var quoted bool
+		var err error
+		key, value, quoted, rest, err = nextPair(rest)
+		if err != nil {
+			return entry{}, err
+		}
+
+		if key == "msg" {
+			message, found = value, true
+			continue
+		}
+		if err := setField(context, key, logfmtValue(value, quoted)); err != nil {
+			return entry{}, err
+		}
+	}
+	if !found {
+		return entry{}, errors.New("logfmt: no msg key")
+	}
+
+	// the entry is converted to format/json for -o json
+	out, err := json.JSON(context, message)
+	if err != nil {
+		return entry{}, err
+	}
+	return newEntry(out, context, message), nil
+}
+
+// nextPair returns the first key=value pair of s and the rest of s.
+// A key without value is true.
+func nextPair(s string) (key, value string, quoted bool, rest string, err error) {
+	i := strings.IndexAny(s, "= \t")
+	if i < 0 {
+		return s, "true", false, "", nil
+	}
+	key = s[:i]
+	if key == "" {
+		return "", "", false, "", fmt.Errorf("logfmt: %q: missing key", s)
+	}
+	if s[i] != '=' {
+		return key, "true", false, s[i:], nil
+	}
+
+	s = s[i+1:]
+	if !strings.HasPrefix(s, `"`) {
+		if j := strings.IndexAny(s, " \t"); j >= 0 {
+			return key, s[:j], false, s[j:], nil
+		}
+		return key, s, false, "", nil
+	}
+
+	// the closing quote is the first one not escaped
+	for j := 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			value, err := strconv.Unquote(s[:j+1])
+			if err != nil {
+				return "", "", false, "", fmt.Errorf("logfmt: %s: %w", key, err)
+			}
+			return key, value, true, s[j+1:], nil
+		}
+	}
+	return "", "", false, "", fmt.Errorf("logfmt: %s: unterminated quote", key)
+}
+
+// logfmtValue returns the unquoted numbers, booleans and null
+// as JSON values, and the other values as strings
+func logfmtValue(value string, quoted bool) interface{} {
+	if quoted {
+		return value
+	}
+
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil && libjson.Valid([]byte(value)) {
+		return libjson.Number(value)
+	}
+	return value
+}
+
+// setField sets the field of context at the dotted key
+func setField(context map[string]interface{}, key string, value interface{}) error {
+	names := strings.Split(key, ".")
+	m := context
+	for _, name := range names[:len(names)-1] {
+		v, ok := m[name]
+		if !ok {
+			sub := make(map[string]interface{})
+			m[name] = sub
+			m = sub
+			continue
+		}
+		if m, ok = v.(map[string]interface{}); !ok {
+			return fmt.Errorf("logfmt: %s: %s is not an object", key, name)
+		}
+	}
+
+	name := names[len(names)-1]
+	if _, ok := m[name]; ok {
+		return fmt.Errorf("logfmt: %s: duplicate key", key)
+	}
+	m[name] = value
+	return nil
+}
@@ -0,0 +1,269 @@
+// Command genelog reads the logs written by format/json, or logfmt
+// logs, from files or stdin, filters them and prints them in a
+// readable format or converts them.
+//
+// Usage:
+//
+//	genelog [flags] [file ...]
+//
+// Examples:
+//
+//	genelog -level warning app.log
+//	genelog -since 15m -grep timeout -where request.status>=500 app.log
+//	genelog -f -o logfmt app.log
+//	kubectl logs app | genelog -where module=db
+//	genelog -i logfmt -o json app.log
+//
+// The console format is for reading only: it can't be read back.
+// Lines not in the input format are printed unchanged when no
+// filter is set, and dropped otherwise.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+
+	"github.com/6prod/genelog/field/level"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// expressions is a repeatable flag of field expressions
+type expressions []expression
+
+func (e *expressions) String() string {
+	return fmt.Sprint(*e)
+}
+
+func (e *expressions) Set(s string) error {
+	expr, err := parseExpression(s)
+	if err != nil {
+		return err
+	}
+	*e = append(*e, expr)
+	return nil
+}
+
+// options are the parsed command line flags
+type options struct {
+	filter   filter
+	input    string
+	format   string
+	color    bool
+	follow   bool
+	interval time.Duration
+	files    []string
+}
+
+func parseOptions(args []string, stdout, stderr io.Writer) (options, error) {
+	flags := flag.NewFlagSet("genelog", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: genelog [flags] [file ...]\n\n")
+		fmt.Fprintf(stderr, "Reads format/json or logfmt logs from the files, or stdin, and prints them.\n\n")
+		flags.PrintDefaults()
+	}
+
+	var (
+		minLevel = flags.String("level", "", "minimum `level` of the entries")
+		since    = flags.String("since", "", "entries at or after `time`, RFC 3339 or a duration ago like 15m")
+		until    = flags.String("until", "", "entries before `time`, RFC 3339 or a duration ago like 15m")
+		grep     = flags.String("grep", "", "entries with a message matching `regexp`")
+		input    = flags.String("i", "json", "input `format`: json or logfmt")
+		format   = flags.String("o", "console", "output `format`: console, json or logfmt")
+		colors   = flags.String("color", "auto", "colorize the levels: auto, always or never")
+		follow   = flags.Bool("f", false, "follow the files as they grow")
+		interval = flags.Duration("interval", 250*time.Millisecond, "polling `interval` of the followed files")
+		where    expressions
+	)
+	flags.Var(&where, "where", "entries with a context field matching `expr`: key=value, key!=value,\nkey~regexp, key!~regexp, key>n, key>=n, key<n or key<=n; repeatable")
+
+	if err := flags.Parse(args); err != nil {
+		return options{}, err
+	}
+
+	o := options{
+		input:    *input,
+		format:   *format,
+		follow:   *follow,
+		interval: *interval,
+		files:    flags.Args(),
+	}
+	o.filter.where = where
+
+	if *minLevel != "" {
+		l, ok := level.NewLevelFromString(*minLevel)
+		if !ok {
+			return options{}, fmt.Errorf("-level: %s: unknown level", *minLevel)
+		}
+		o.filter.level = l
+	}
+
+	now := time.Now()
+	var err error
+	if o.filter.since, err = parseTime(*since, now); err != nil {
+		return options{}, fmt.Errorf("-since: %w", err)
+	}
+	if o.filter.until, err = parseTime(*until, now); err != nil {
+		return options{}, fmt.Errorf("-until: %w", err)
+	}
+
+	if *grep != "" {
+		if o.filter.grep, err = regexp.Compile(*grep); err != nil {
+			return options{}, fmt.Errorf("-grep: %w", err)
+		}
+	}
+
+	if _, ok := decoders[o.input]; !ok {
+		return options{}, fmt.Errorf("-i: %s: unknown format", o.input)
+	}
+	if _, ok := encoders[o.format]; !ok {
+		return options{}, fmt.Errorf("-o: %s: unknown format", o.format)
+	}
+
+	switch *colors {
+	case "always":
+		o.color = true
+	case "never":
+	case "auto":
+		f, ok := stdout.(*os.File)
+		o.color = ok && isatty.IsTerminal(f.Fd()) && os.Getenv("NO_COLOR") == ""
+	default:
+		return options{}, fmt.Errorf("-color: %s: want auto, always or never", *colors)
+	}
+
+	if o.follow && len(o.files) == 0 {
+		return options{}, errors.New("-f: no file to follow")
+	}
+
+	return o, nil
+}
+
+// parseTime parses an RFC 3339 time, or a duration before now
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	o, err := parseOptions(args, stdout, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "genelog: %s\n", err)
+		return 2
+	}
+
+	// level colors are computed at init: use the color objects
+	color.NoColor = !o.color
+
+	p := &printer{
+		w:      stdout,
+		filter: o.filter,
+		decode: decoders[o.input],
+		encode: encoders[o.format],
+		color:  o.color,
+	}
+
+	if len(o.files) == 0 {
+		if err := read(stdin, p.print); err != nil {
+			fmt.Fprintf(stderr, "genelog: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, path := range o.files {
+		fail := func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(stderr, "genelog: %s\n", err)
+			status = 1
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			fail(err)
+			continue
+		}
+
+		if !o.follow {
+			if err := read(f, p.print); err != nil {
+				fail(fmt.Errorf("%s: %w", path, err))
+			}
+			f.Close()
+			continue
+		}
+
+		wg.Add(1)
+		go func(path string, f *os.File) {
+			defer wg.Done()
+			defer f.Close()
+			if err := followFile(ctx, f, o.interval, p.print); err != nil {
+				fail(fmt.Errorf("%s: %w", path, err))
+			}
+		}(path, f)
+	}
+	wg.Wait()
+
+	return status
+}
+
+// printer prints the entries matching the filter
+type printer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	filter filter
+	decode decoder
+	encode encoder
+	color  bool
+}
+
+func (p *printer) print(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	e, err := p.decode(line)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		if p.filter.empty() {
+			fmt.Fprintln(p.w, line)
+		}
+		return
+	}
+	if !p.filter.match(e) {
+		return
+	}
+	fmt.Fprintln(p.w, p.encode(e, p.color))
+}
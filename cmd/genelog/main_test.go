@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testLogs = `{"context":{"level":"debug","time":"2022-02-01T12:30:00Z","module":"db"},"message":"connecting"}
+{"context":{"level":"info","time":"2022-02-01T12:31:00Z","request":{"method":"GET","status":200}},"message":"GET /index.html"}
+not a log line
+{"context":{"level":"error","time":"2022-02-01T12:32:00Z","request":{"method":"POST","status":503}},"message":"POST /api timeout"}
+`
+
+func runTest(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	status := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), status
+}
+
+func TestRun(t *testing.T) {
+	testSuite := map[string]struct {
+		args []string
+		want string
+	}{
+		"console": {
+			[]string{"-color", "never"},
+			"2022-02-01T12:30:00Z DEBUG   connecting module=db\n" +
+				"2022-02-01T12:31:00Z INFO    GET /index.html request.method=GET request.status=200\n" +
+				"not a log line\n" +
+				"2022-02-01T12:32:00Z ERROR   POST /api timeout request.method=POST request.status=503\n",
+		},
+		"level": {
+			[]string{"-level", "INFO", "-o", "json"},
+			`{"context":{"level":"info","time":"2022-02-01T12:31:00Z","request":{"method":"GET","status":200}},"message":"GET /index.html"}` + "\n" +
+				`{"context":{"level":"error","time":"2022-02-01T12:32:00Z","request":{"method":"POST","status":503}},"message":"POST /api timeout"}` + "\n",
+		},
+		"time range": {
+			[]string{"-since", "2022-02-01T12:31:00Z", "-until", "2022-02-01T12:32:00Z", "-o", "logfmt"},
+			`time=2022-02-01T12:31:00Z level=info msg="GET /index.html" request.method=GET request.status=200` + "\n",
+		},
+		"grep": {
+			[]string{"-grep", "time(out)?$", "-o", "logfmt"},
+			`time=2022-02-01T12:32:00Z level=error msg="POST /api timeout" request.method=POST request.status=503` + "\n",
+		},
+		"where": {
+			[]string{"-where", "request.status>=500", "-where", "request.method~^P", "-o", "logfmt"},
+			`time=2022-02-01T12:32:00Z level=error msg="POST /api timeout" request.method=POST request.status=503` + "\n",
+		},
+		"where missing field": {
+			[]string{"-where", "module!=db", "-o", "logfmt"},
+			`time=2022-02-01T12:31:00Z level=info msg="GET /index.html" request.method=GET request.status=200` + "\n" +
+				`time=2022-02-01T12:32:00Z level=error msg="POST /api timeout" request.method=POST request.status=503` + "\n",
+		},
+	}
+
+	for name, test := range testSuite {
+		stdout, stderr, status := runTest(t, testLogs, test.args...)
+		if status != 0 {
+			t.Fatalf("%s: status %d: %s", name, status, stderr)
+		}
+		if stdout != test.want {
+			t.Fatalf("%s:\nwant:\n%s\ngot:\n%s", name, test.want, stdout)
+		}
+	}
+}
+
+const testLogfmt = `time=2022-02-01T12:30:00Z level=debug msg=connecting module=db
+time=2022-02-01T12:31:00Z level=info msg="GET /index.html" request.method=GET request.status=200
+not a log line
+time=2022-02-01T12:32:00Z level=error msg="POST /api timeout" request.method=POST request.status=503 request.retry=true
+`
+
+func TestRun_logfmt(t *testing.T) {
+	testSuite := map[string]struct {
+		args []string
+		want string
+	}{
+		"console": {
+			[]string{"-i", "logfmt", "-color", "never"},
+			"2022-02-01T12:30:00Z DEBUG   connecting module=db\n" +
+				"2022-02-01T12:31:00Z INFO    GET /index.html request.method=GET request.status=200\n" +
+				"not a log line\n" +
+				"2022-02-01T12:32:00Z ERROR   POST /api timeout request.method=POST request.retry=true request.status=503\n",
+		},
+		"json": {
+			[]string{"-i", "logfmt", "-where", "request.status>=200", "-o", "json"},
+			`{"context":{"level":"info","request":{"method":"GET","status":200},"time":"2022-02-01T12:31:00Z"},"message":"GET /index.html"}` + "\n" +
+				`{"context":{"level":"error","request":{"method":"POST","retry":true,"status":503},"time":"2022-02-01T12:32:00Z"},"message":"POST /api timeout"}` + "\n",
+		},
+		"logfmt": {
+			[]string{"-i", "logfmt", "-level", "error", "-o", "logfmt"},
+			`time=2022-02-01T12:32:00Z level=error msg="POST /api timeout" request.method=POST request.retry=true request.status=503` + "\n",
+		},
+	}
+
+	for name, test := range testSuite {
+		stdout, stderr, status := runTest(t, testLogfmt, test.args...)
+		if status != 0 {
+			t.Fatalf("%s: status %d: %s", name, status, stderr)
+		}
+		if stdout != test.want {
+			t.Fatalf("%s:\nwant:\n%s\ngot:\n%s", name, test.want, stdout)
+		}
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	e, err := parseLogfmt(`msg="say \"hi\"" a.b=1 a.c="x y" flag empty=""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `{"context":{"a":{"b":1,"c":"x y"},"empty":"","flag":true},"message":"say \"hi\""}`, e.line; want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	for _, line := range []string{"not a log line", `msg="open`, "msg=x a=1 a.b=2", "msg=x =1"} {
+		if _, err := parseLogfmt(line); err == nil {
+			t.Fatalf("%s: want an error", line)
+		}
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	testSuite := map[string][]string{
+		"level":      {"-level", "loud"},
+		"since":      {"-since", "yesterday"},
+		"grep":       {"-grep", "("},
+		"where":      {"-where", "status"},
+		"input":      {"-i", "console"},
+		"format":     {"-o", "xml"},
+		"color":      {"-color", "sometimes"},
+		"follow":     {"-f"},
+		"no file":    {filepath.Join(t.TempDir(), "missing.log")},
+		"bad option": {"-x"},
+	}
+
+	for name, args := range testSuite {
+		_, stderr, status := runTest(t, "", args...)
+		if status == 0 || stderr == "" {
+			t.Fatalf("%s: want an error, got status %d", name, status)
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	testSuite := map[string]expression{
+		"a=b":       {key: "a", op: "=", value: "b"},
+		"a.b!=c=d":  {key: "a.b", op: "!=", value: "c=d"},
+		"n>=10":     {key: "n", op: ">=", value: "10"},
+		"n<3":       {key: "n", op: "<", value: "3"},
+		"msg!~^x.*": {key: "msg", op: "!~", value: "^x.*"},
+	}
+
+	for s, want := range testSuite {
+		got, err := parseExpression(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		if got.key != want.key || got.op != want.op || got.value != want.value {
+			t.Fatalf("%s: want: %+v, got: %+v", s, want, got)
+		}
+	}
+}
+
+// syncBuffer is a buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRun_follow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(`{"context":{"level":"info"},"message":"first"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stdout, stderr := &syncBuffer{}, &syncBuffer{}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-f", "-interval", "5ms", "-o", "logfmt", path}, nil, stdout, stderr)
+	}()
+
+	wait := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for stdout.String() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("want:\n%s\ngot:\n%s", want, stdout.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	wait("level=info msg=first\n")
+
+	// a line written in two parts is printed once complete
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(`{"context":{"level":"info"},`); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := f.WriteString(`"message":"second"}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	wait("level=info msg=first\nlevel=info msg=second\n")
+
+	// a truncated file is read from the start
+	if err := os.WriteFile(path, []byte(`{"context":{"level":"info"},"message":"third"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wait("level=info msg=first\nlevel=info msg=second\nlevel=info msg=third\n")
+
+	cancel()
+	if status := <-done; status != 0 {
+		t.Fatalf("status %d: %s", status, stderr.String())
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// read calls fn with each line of r
+func read(r io.Reader, fn func(line string)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			fn(strings.TrimSuffix(line, "\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// followFile calls fn with each line of f, then waits for new
+// lines until ctx is done. The file is read again from the start
+// when it is truncated.
+func followFile(ctx context.Context, f *os.File, interval time.Duration, fn func(line string)) error {
+	reader := bufio.NewReader(f)
+	partial := ""
+
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err == nil {
+			fn(strings.TrimSuffix(partial, "\n"))
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		// the buffer is empty at EOF: the offset is the position read
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() < offset {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			reader.Reset(f)
+			partial = ""
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/caller"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/seq"
+	libtime "github.com/6prod/genelog/field/time"
+)
+
+// Context is the context of the built loggers.
+//
+// It implements the interfaces used by the hooks of the Default
+// registry, and is encoded with its set fields only.
+type Context struct {
+	*level.WithLevel
+	*libtime.WithTime
+	*caller.WithCaller
+	*seq.WithSeq
+	// Module is the name given to Loggers.Module
+	Module string
+}
+
+// NewContext returns a context logging from level min
+func NewContext(min level.Level, module string) Context {
+	return Context{
+		WithLevel:  level.NewWithLevel(min),
+		WithTime:   libtime.NewWithTime(time.Time{}),
+		WithCaller: caller.NewWithCaller(),
+		WithSeq:    seq.NewWithSeq(),
+		Module:     module,
+	}
+}
+
+func (c Context) MarshalJSON() ([]byte, error) {
+	var t *time.Time
+	if !c.Time().IsZero() {
+		now := c.Time()
+		t = &now
+	}
+	file, line := c.Caller()
+
+	return json.Marshal(struct {
+		Level  level.Level `json:"level"`
+		Time   *time.Time  `json:"time,omitempty"`
+		Module string      `json:"module,omitempty"`
+		File   string      `json:"file,omitempty"`
+		Line   int         `json:"line,omitempty"`
+		Seq    uint64      `json:"seq,omitempty"`
+		ID     string      `json:"id,omitempty"`
+	}{
+		Level:  c.Level(),
+		Time:   t,
+		Module: c.Module,
+		File:   file,
+		Line:   line,
+		Seq:    c.Seq(),
+		ID:     c.ID(),
+	})
+}
+
+// newText returns a format writing the time, level,
+// module, message and caller of an entry on one line
+func newText(color bool, timeFormat string) genelog.Format {
+	return func(v interface{}, msg string) (string, error) {
+		parts := make([]string, 0, 5)
+
+		if timer, ok := v.(libtime.Timer); ok && !timer.Time().IsZero() {
+			parts = append(parts, timer.Time().Format(timeFormat))
+		}
+		if leveler, ok := level.GetLeveler(v); ok && leveler.Level() != level.UNSET {
+			if color {
+				parts = append(parts, leveler.Level().Color())
+			} else {
+				parts = append(parts, leveler.Level().String())
+			}
+		}
+		if context, ok := v.(Context); ok && context.Module != "" {
+			parts = append(parts, "["+context.Module+"]")
+		}
+
+		parts = append(parts, msg)
+
+		if c, ok := v.(caller.Caller); ok {
+			if file, line := c.Caller(); file != "" {
+				parts = append(parts, fmt.Sprintf("(%s:%d)", filepath.Base(file), line))
+			}
+		}
+		return strings.Join(parts, " "), nil
+	}
+}
+
+// pipeline is a built logger and its minimum level
+type pipeline struct {
+	logger *genelog.Logger
+	min    level.Level
+	// routed is the logger filtering the entries below min,
+	// for the contexts of a Handle not having min set
+	routed *genelog.Logger
+}
+
+func newPipeline(logger *genelog.Logger, min level.Level) pipeline {
+	return pipeline{
+		logger: logger,
+		min:    min,
+		routed: genelog.Tee(logger).AddHook(level.NewHookLevelMin(min)),
+	}
+}
+
+// Loggers is a tree of loggers built from a configuration
+type Loggers struct {
+	root    pipeline
+	modules map[string]pipeline
+	closers []io.Closer
+}
+
+// Build builds the loggers of config with the Default registry
+func Build(config *Config) (*Loggers, error) {
+	return Default.Build(config)
+}
+
+// Build builds the loggers of config.
+//
+// Outputs with the same type and options share their writer, and
+// the lock serializing the writes to it. On error, the writers
+// already opened are closed.
+func (r *Registry) Build(config *Config) (*Loggers, error) {
+	b := &builder{
+		registry: r,
+		outputs:  make(map[string]*genelog.Logger),
+	}
+
+	root, err := b.pipeline(spec{
+		level:      config.Level,
+		format:     config.Format,
+		outputs:    config.Outputs,
+		hooks:      config.Hooks,
+		levelKey:   "level",
+		formatKey:  "format",
+		outputsKey: "outputs",
+		hooksKey:   "hooks",
+	})
+	if err != nil {
+		b.close()
+		return nil, err
+	}
+
+	loggers := &Loggers{
+		root:    root,
+		modules: make(map[string]pipeline, len(config.Modules)),
+	}
+
+	names := make([]string, 0, len(config.Modules))
+	for name := range config.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		module := config.Modules[name]
+		key := join("modules", name)
+
+		if name == "" {
+			b.close()
+			return nil, &KeyError{key, ErrMissingKey}
+		}
+
+		// only the level changes: share the root pipeline
+		if module.Format == nil && len(module.Outputs) == 0 && module.Hooks == nil {
+			min, err := parseLevel(join(key, "level"), module.Level, root.min)
+			if err != nil {
+				b.close()
+				return nil, err
+			}
+			loggers.modules[name] = newPipeline(root.logger, min)
+			continue
+		}
+
+		s := spec{
+			level:      config.Level,
+			format:     config.Format,
+			outputs:    config.Outputs,
+			hooks:      config.Hooks,
+			levelKey:   "level",
+			formatKey:  "format",
+			outputsKey: "outputs",
+			hooksKey:   "hooks",
+		}
+		if module.Level != "" {
+			s.level, s.levelKey = module.Level, join(key, "level")
+		}
+		if module.Format != nil {
+			s.format, s.formatKey = *module.Format, join(key, "format")
+		}
+		if len(module.Outputs) > 0 {
+			s.outputs, s.outputsKey = module.Outputs, join(key, "outputs")
+		}
+		if module.Hooks != nil {
+			s.hooks, s.hooksKey = module.Hooks, join(key, "hooks")
+		}
+
+		p, err := b.pipeline(s)
+		if err != nil {
+			b.close()
+			return nil, err
+		}
+		loggers.modules[name] = p
+	}
+
+	loggers.closers = b.closers
+	return loggers, nil
+}
+
+// Logger returns a root logger with a new context
+func (l *Loggers) Logger() level.LevelLogger {
+	return newLogger(l.root, "")
+}
+
+// Module returns a logger of module name with a new context.
+//
+// Dotted names inherit the configuration of their parents:
+// "db.pool" is configured by "db" if not configured itself,
+// and by the root if neither are.
+func (l *Loggers) Module(name string) level.LevelLogger {
+	return newLogger(l.lookup(name), name)
+}
+
+// lookup returns the pipeline configuring module name
+func (l *Loggers) lookup(name string) pipeline {
+	for n := name; n != ""; n = parent(n) {
+		if module, ok := l.modules[n]; ok {
+			return module
+		}
+	}
+	return l.root
+}
+
+// Close closes the writers of the outputs
+func (l *Loggers) Close() error {
+	var err error
+	for _, closer := range l.closers {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func newLogger(p pipeline, module string) level.LevelLogger {
+	return level.LevelLogger{Logger: p.logger.WithContext(NewContext(p.min, module))}
+}
+
+func parent(name string) string {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+func parseLevel(key, s string, def level.Level) (level.Level, error) {
+	if s == "" {
+		return def, nil
+	}
+	l, ok := level.NewLevelFromString(s)
+	if !ok {
+		return level.UNSET, &KeyError{key, fmt.Errorf("%s: unknown level", s)}
+	}
+	return l, nil
+}
+
+// spec is the configuration of a pipeline
+// and the keys of its parts for the errors
+type spec struct {
+	level   string
+	format  Plugin
+	outputs []Output
+	hooks   []Plugin
+
+	levelKey   string
+	formatKey  string
+	outputsKey string
+	hooksKey   string
+}
+
+// builder builds pipelines sharing their writers
+type builder struct {
+	registry *Registry
+	// outputs are the loggers of the opened writers by type and
+	// options, cloned by the branches writing to them
+	outputs map[string]*genelog.Logger
+	closers []io.Closer
+}
+
+func (b *builder) pipeline(s spec) (pipeline, error) {
+	min, err := parseLevel(s.levelKey, s.level, level.INFO)
+	if err != nil {
+		return pipeline{}, err
+	}
+
+	if s.format.Type == "" && s.format.Options == nil {
+		s.format.Type = "json"
+	}
+	format, err := b.registry.format(s.formatKey, s.format)
+	if err != nil {
+		return pipeline{}, err
+	}
+
+	outputs := s.outputs
+	if len(outputs) == 0 {
+		outputs = []Output{{Plugin: Plugin{Type: "stderr"}}}
+	}
+
+	branches := make([]*genelog.Logger, 0, len(outputs))
+	for i, output := range outputs {
+		key := index(s.outputsKey, i)
+
+		out, err := b.output(key, output.Plugin)
+		if err != nil {
+			return pipeline{}, err
+		}
+
+		branch := out.WithFormatter(format)
+		if output.Format != nil {
+			f, err := b.registry.format(join(key, "format"), *output.Format)
+			if err != nil {
+				return pipeline{}, err
+			}
+			branch = branch.WithFormatter(f)
+		}
+		if output.Level != "" {
+			min, err := parseLevel(join(key, "level"), output.Level, level.UNSET)
+			if err != nil {
+				return pipeline{}, err
+			}
+			branch = branch.AddHook(level.NewHookLevelMin(min))
+		}
+		branches = append(branches, branch)
+	}
+
+	logger := branches[0]
+	if len(branches) > 1 {
+		logger = genelog.Tee(branches...)
+	}
+
+	for i, plugin := range s.hooks {
+		hook, ordered, err := b.registry.hook(index(s.hooksKey, i), plugin)
+		if err != nil {
+			return pipeline{}, err
+		}
+		if ordered {
+			logger = logger.AddOrderedHook(hook)
+			continue
+		}
+		logger = logger.AddHook(hook)
+	}
+
+	return newPipeline(logger, min), nil
+}
+
+// output returns a logger writing to the writer of an output,
+// opened once per type and options. The branches clone it, to
+// share the lock of the writer.
+func (b *builder) output(key string, plugin Plugin) (*genelog.Logger, error) {
+	id, err := json.Marshal(plugin)
+	if err == nil {
+		if logger, ok := b.outputs[string(id)]; ok {
+			return logger, nil
+		}
+	}
+
+	w, err := b.registry.sink(key, plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := genelog.New(w)
+	if id != nil {
+		b.outputs[string(id)] = logger
+	}
+	if closer, ok := w.(io.Closer); ok {
+		b.closers = append(b.closers, closer)
+	}
+	return logger, nil
+}
+
+func (b *builder) close() {
+	for _, closer := range b.closers {
+		_ = closer.Close()
+	}
+}
@@ -0,0 +1,492 @@
+// Package config builds loggers from a configuration document
+// in YAML or JSON, or from environment variables.
+//
+// Example document:
+//
+//	level: info
+//	format: json
+//	outputs:
+//	  - stderr
+//	  - type: file
+//	    path: /var/log/app.log
+//	    level: warning
+//	    format: text
+//	hooks:
+//	  - time
+//	  - type: redact
+//	    keys: [password, token]
+//	modules:
+//	  db:
+//	    level: debug
+//
+// Formats, outputs and hooks are given by their registered type,
+// as a string or as a mapping with a type key and the options of
+// the type. Third-party packages add types to the Registry.
+//
+// Invalid documents are reported with a KeyError naming the
+// offending key, such as "outputs[1].path".
+//
+// A Handle reloads the configuration of its loggers without
+// restart, on Reload or when the configuration file changes.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/6prod/genelog/field/level"
+)
+
+var (
+	// ErrUnknownKey is returned for keys not part of the document
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrMissingKey is returned for required keys not set
+	ErrMissingKey = errors.New("missing key")
+)
+
+// KeyError is a configuration error located at Key
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// Plugin is a format, output or hook: a registered type and its options
+type Plugin struct {
+	Type    string
+	Options map[string]interface{}
+}
+
+// Output is a sink with an optional minimum level and format
+type Output struct {
+	Plugin
+	// Level is the minimum level of the output, empty for all
+	Level string
+	// Format overrides the format of the logger if not nil
+	Format *Plugin
+}
+
+// Module overrides the configuration of the loggers of a module.
+//
+// Unset fields are inherited from the root configuration.
+type Module struct {
+	Level   string
+	Format  *Plugin
+	Outputs []Output
+	Hooks   []Plugin
+}
+
+// Config describes a logger tree
+type Config struct {
+	// Level is the minimum level, "info" if empty
+	Level string
+	// Format is the output format, "json" if the type is empty
+	Format Plugin
+	// Outputs are the sinks, "stderr" if empty
+	Outputs []Output
+	// Hooks run in order on each entry
+	Hooks []Plugin
+	// Modules are configurations by module name
+	Modules map[string]Module
+}
+
+// Parse decodes a document in format "yaml" or "json"
+func Parse(data []byte, format string) (*Config, error) {
+	var doc interface{}
+
+	switch format {
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case "json":
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown configuration format", format)
+	}
+
+	return decodeConfig(doc)
+}
+
+// LoadFile decodes the document at path in the format
+// given by its extension
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := Parse(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// LoadEnv overrides config with the environment variables
+// starting with prefix:
+//
+//	<prefix>_LEVEL=debug
+//	<prefix>_FORMAT=text
+//	<prefix>_OUTPUTS=stderr,file?path=/var/log/app.log&level=warning
+//	<prefix>_HOOKS=time,caller
+//	<prefix>_LEVELS=db=debug,http=warning
+//
+// Outputs and hooks are comma separated types, with options in
+// a query string. LEVELS sets the level of modules.
+func LoadEnv(config *Config, prefix string) error {
+	if v, ok := os.LookupEnv(prefix + "_LEVEL"); ok {
+		if err := checkLevel(prefix+"_LEVEL", v); err != nil {
+			return err
+		}
+		config.Level = v
+	}
+
+	if v, ok := os.LookupEnv(prefix + "_FORMAT"); ok {
+		plugin, err := envPlugin(prefix+"_FORMAT", v)
+		if err != nil {
+			return err
+		}
+		config.Format = plugin
+	}
+
+	if v, ok := os.LookupEnv(prefix + "_OUTPUTS"); ok {
+		key := prefix + "_OUTPUTS"
+		outputs := make([]Output, 0)
+		for _, s := range envList(v) {
+			plugin, err := envPlugin(key, s)
+			if err != nil {
+				return err
+			}
+			output, err := decodeOutput(key, plugin)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, output)
+		}
+		config.Outputs = outputs
+	}
+
+	if v, ok := os.LookupEnv(prefix + "_HOOKS"); ok {
+		hooks := make([]Plugin, 0)
+		for _, s := range envList(v) {
+			plugin, err := envPlugin(prefix+"_HOOKS", s)
+			if err != nil {
+				return err
+			}
+			hooks = append(hooks, plugin)
+		}
+		config.Hooks = hooks
+	}
+
+	if v, ok := os.LookupEnv(prefix + "_LEVELS"); ok {
+		key := prefix + "_LEVELS"
+		for _, s := range envList(v) {
+			i := strings.Index(s, "=")
+			if i <= 0 {
+				return &KeyError{key, fmt.Errorf("%s: want module=level", s)}
+			}
+			name, l := s[:i], s[i+1:]
+			if err := checkLevel(key, l); err != nil {
+				return err
+			}
+			if config.Modules == nil {
+				config.Modules = make(map[string]Module)
+			}
+			module := config.Modules[name]
+			module.Level = l
+			config.Modules[name] = module
+		}
+	}
+
+	return nil
+}
+
+func envList(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envPlugin decodes "type?option=value"
+func envPlugin(key, s string) (Plugin, error) {
+	i := strings.Index(s, "?")
+	if i < 0 {
+		return Plugin{Type: s}, nil
+	}
+
+	query, err := url.ParseQuery(s[i+1:])
+	if err != nil {
+		return Plugin{}, &KeyError{key, err}
+	}
+
+	options := make(map[string]interface{})
+	for name, values := range query {
+		if len(values) == 1 {
+			options[name] = values[0]
+			continue
+		}
+		list := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			list = append(list, v)
+		}
+		options[name] = list
+	}
+	return Plugin{Type: s[:i], Options: options}, nil
+}
+
+func checkLevel(key, s string) error {
+	if _, ok := level.NewLevelFromString(s); !ok {
+		return &KeyError{key, fmt.Errorf("%s: unknown level", s)}
+	}
+	return nil
+}
+
+func join(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func index(parent string, i int) string {
+	return fmt.Sprintf("%s[%d]", parent, i)
+}
+
+// mapping returns v as a mapping, sorted keys included
+// for the errors to be reported in a stable order
+func mapping(key string, v interface{}) (map[string]interface{}, []string, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil, &KeyError{key, fmt.Errorf("want a mapping, got %T", v)}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return m, keys, nil
+}
+
+func sequence(key string, v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return []interface{}{}, nil
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, &KeyError{key, fmt.Errorf("want a list, got %T", v)}
+	}
+	return list, nil
+}
+
+func decodeString(key string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", &KeyError{key, fmt.Errorf("want a string, got %T", v)}
+	}
+	return s, nil
+}
+
+func decodeLevel(key string, v interface{}) (string, error) {
+	s, err := decodeString(key, v)
+	if err != nil {
+		return "", err
+	}
+	return s, checkLevel(key, s)
+}
+
+func decodeConfig(doc interface{}) (*Config, error) {
+	m, keys, err := mapping("", doc)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	for _, k := range keys {
+		v := m[k]
+		switch k {
+		case "level":
+			config.Level, err = decodeLevel(k, v)
+		case "format":
+			config.Format, err = decodePlugin(k, v)
+		case "outputs":
+			config.Outputs, err = decodeOutputs(k, v)
+		case "hooks":
+			config.Hooks, err = decodePlugins(k, v)
+		case "modules":
+			config.Modules, err = decodeModules(k, v)
+		default:
+			err = &KeyError{k, ErrUnknownKey}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// decodePlugin decodes a type or a mapping with a type and options
+func decodePlugin(key string, v interface{}) (Plugin, error) {
+	if s, ok := v.(string); ok {
+		return Plugin{Type: s}, nil
+	}
+
+	m, _, err := mapping(key, v)
+	if err != nil {
+		return Plugin{}, err
+	}
+
+	t, ok := m["type"]
+	if !ok {
+		return Plugin{}, &KeyError{join(key, "type"), ErrMissingKey}
+	}
+	typ, err := decodeString(join(key, "type"), t)
+	if err != nil {
+		return Plugin{}, err
+	}
+
+	options := make(map[string]interface{}, len(m)-1)
+	for k, v := range m {
+		if k != "type" {
+			options[k] = v
+		}
+	}
+	return Plugin{Type: typ, Options: options}, nil
+}
+
+func decodePlugins(key string, v interface{}) ([]Plugin, error) {
+	list, err := sequence(key, v)
+	if err != nil {
+		return nil, err
+	}
+
+	plugins := make([]Plugin, 0, len(list))
+	for i, v := range list {
+		plugin, err := decodePlugin(index(key, i), v)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+func decodeOutputs(key string, v interface{}) ([]Output, error) {
+	list, err := sequence(key, v)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]Output, 0, len(list))
+	for i, v := range list {
+		plugin, err := decodePlugin(index(key, i), v)
+		if err != nil {
+			return nil, err
+		}
+		output, err := decodeOutput(index(key, i), plugin)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// decodeOutput moves the level and format options to the output
+func decodeOutput(key string, plugin Plugin) (Output, error) {
+	output := Output{Plugin: plugin}
+
+	if v, ok := plugin.Options["level"]; ok {
+		l, err := decodeLevel(join(key, "level"), v)
+		if err != nil {
+			return Output{}, err
+		}
+		output.Level = l
+		delete(plugin.Options, "level")
+	}
+
+	if v, ok := plugin.Options["format"]; ok {
+		format, err := decodePlugin(join(key, "format"), v)
+		if err != nil {
+			return Output{}, err
+		}
+		output.Format = &format
+		delete(plugin.Options, "format")
+	}
+
+	return output, nil
+}
+
+func decodeModules(key string, v interface{}) (map[string]Module, error) {
+	m, keys, err := mapping(key, v)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]Module, len(m))
+	for _, name := range keys {
+		module, err := decodeModule(join(key, name), m[name])
+		if err != nil {
+			return nil, err
+		}
+		modules[name] = module
+	}
+	return modules, nil
+}
+
+func decodeModule(key string, v interface{}) (Module, error) {
+	m, keys, err := mapping(key, v)
+	if err != nil {
+		return Module{}, err
+	}
+
+	module := Module{}
+	for _, k := range keys {
+		v := m[k]
+		switch k {
+		case "level":
+			module.Level, err = decodeLevel(join(key, k), v)
+		case "format":
+			var format Plugin
+			format, err = decodePlugin(join(key, k), v)
+			module.Format = &format
+		case "outputs":
+			module.Outputs, err = decodeOutputs(join(key, k), v)
+		case "hooks":
+			module.Hooks, err = decodePlugins(join(key, k), v)
+		default:
+			err = &KeyError{join(key, k), ErrUnknownKey}
+		}
+		if err != nil {
+			return Module{}, err
+		}
+	}
+	return module, nil
+}
@@ -0,0 +1,715 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+func ExampleBuild() {
+	config, err := Parse([]byte(`
+level: info
+format: text
+outputs: [stdout]
+modules:
+  db:
+    level: debug
+    format: json
+`), "yaml")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	loggers, err := Build(config)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer loggers.Close()
+
+	loggers.Logger().Infoln("started")
+	loggers.Logger().Debugln("hidden")
+	loggers.Module("db.pool").Debugln("connected")
+
+	// Output:
+	// info started
+	// {"context":{"level":"debug","module":"db.pool"},"message":"connected"}
+}
+
+func ExampleLoadEnv() {
+	os.Setenv("APP_LEVEL", "warning")
+	os.Setenv("APP_FORMAT", "text")
+	os.Setenv("APP_OUTPUTS", "stdout")
+	defer func() {
+		os.Unsetenv("APP_LEVEL")
+		os.Unsetenv("APP_FORMAT")
+		os.Unsetenv("APP_OUTPUTS")
+	}()
+
+	config := &Config{}
+	if err := LoadEnv(config, "APP"); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	loggers, err := Build(config)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer loggers.Close()
+
+	loggers.Logger().Infoln("hidden")
+	loggers.Logger().Warningln("low disk space")
+
+	// Output:
+	// warning low disk space
+}
+
+func TestParse_errors(t *testing.T) {
+	testSuite := map[string]struct {
+		doc string
+		key string
+	}{
+		"unknown root key":   {"levle: info", "levle"},
+		"unknown level":      {"level: loud", "level"},
+		"level not a string": {"level: [info]", "level"},
+		"outputs not a list": {"outputs: stderr", "outputs"},
+		"missing type":       {"outputs: [{path: a.log}]", "outputs[0].type"},
+		"output level":       {"outputs: [stderr, {type: file, level: loud}]", "outputs[1].level"},
+		"hook type":          {"hooks: [{type: 1}]", "hooks[0].type"},
+		"module key":         {"modules: {db: {lvl: debug}}", "modules.db.lvl"},
+		"module level":       {"modules: {db: {level: loud}}", "modules.db.level"},
+		"module output":      {"modules: {db: {outputs: [{}]}}", "modules.db.outputs[0].type"},
+	}
+
+	for name, test := range testSuite {
+		_, err := Parse([]byte(test.doc), "yaml")
+		var keyErr *KeyError
+		if !errors.As(err, &keyErr) {
+			t.Fatalf("%s: want KeyError, got: %v", name, err)
+		}
+		if keyErr.Key != test.key {
+			t.Fatalf("%s: want key: %s, got: %s", name, test.key, err)
+		}
+	}
+}
+
+func TestParse_json(t *testing.T) {
+	config, err := Parse([]byte(`{
+		"level": "debug",
+		"outputs": [{"type": "file", "path": "a.log", "perm": 384, "format": "text"}],
+		"hooks": ["time", {"type": "sample", "first": 10}]
+	}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := config.Outputs[0]
+	if output.Type != "file" || output.Format.Type != "text" || output.Options["path"] != "a.log" {
+		t.Fatalf("%+v: wrong output", output)
+	}
+	if _, ok := output.Options["format"]; ok {
+		t.Fatalf("%+v: format left in the options", output)
+	}
+	if len(config.Hooks) != 2 || config.Hooks[1].Options["first"] != 10.0 {
+		t.Fatalf("%+v: wrong hooks", config.Hooks)
+	}
+}
+
+func TestBuild_errors(t *testing.T) {
+	testSuite := map[string]struct {
+		doc string
+		key string
+	}{
+		"unknown format":   {"format: xml", "format.type"},
+		"unknown output":   {"outputs: [stderr, console]", "outputs[1].type"},
+		"unknown hook":     {"hooks: [time, clock]", "hooks[1].type"},
+		"missing option":   {"outputs: [file]", "outputs[0].path"},
+		"unknown option":   {"outputs: [{type: stderr, color: true}]", "outputs[0].color"},
+		"invalid option":   {"hooks: [{type: sample, tick: soon}]", "hooks[0].tick"},
+		"invalid list":     {"hooks: [{type: redact, keys: [1]}]", "hooks[0].keys[0]"},
+		"factory error":    {"hooks: [{type: sample, first: -1}]", "hooks[0]"},
+		"module format":    {"modules: {db: {format: xml}}", "modules.db.format.type"},
+		"output format":    {"outputs: [{type: stderr, format: xml}]", "outputs[0].format.type"},
+		"syslog protocol":  {"format: {type: syslog, protocol: rfc1}", "format.protocol"},
+		"ratelimit option": {"hooks: [ratelimit]", "hooks[0].rate"},
+	}
+
+	for name, test := range testSuite {
+		config, err := Parse([]byte(test.doc), "yaml")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		_, err = Build(config)
+		var keyErr *KeyError
+		if !errors.As(err, &keyErr) {
+			t.Fatalf("%s: want KeyError, got: %v", name, err)
+		}
+		if keyErr.Key != test.key {
+			t.Fatalf("%s: want key: %s, got: %s", name, test.key, err)
+		}
+	}
+}
+
+func TestBuild_outputs(t *testing.T) {
+	dir := t.TempDir()
+	all := filepath.Join(dir, "all.log")
+	errs := filepath.Join(dir, "errors.log")
+	db := filepath.Join(dir, "db.log")
+
+	config, err := Parse([]byte(fmt.Sprintf(`
+level: debug
+format: text
+outputs:
+  - {type: file, path: %q}
+  - {type: file, path: %q, level: error, format: json}
+modules:
+  db:
+    outputs: [{type: file, path: %q}]
+    hooks: [caller]
+  http:
+    level: warning
+`, all, errs, db)), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggers, err := Build(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggers.Logger().Debugln("starting")
+	loggers.Logger().Errorln("failed")
+	loggers.Module("http").Infoln("request")
+	loggers.Module("http.client").Warningln("slow")
+	loggers.Module("db").Infoln("query")
+
+	if err := loggers.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testSuite := map[string]string{
+		all:  "debug starting\nerror failed\nwarning [http.client] slow\n",
+		errs: `{"context":{"level":"error"},"message":"failed"}` + "\n",
+	}
+	for path, want := range testSuite {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("%s: want: %q, got: %q", filepath.Base(path), want, string(b))
+		}
+	}
+
+	b, err := os.ReadFile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "info [db] query (config_test.go:") {
+		t.Fatalf("%q: no caller in db module", string(b))
+	}
+}
+
+func TestBuild_seqOrder(t *testing.T) {
+	const goroutines, lines = 8, 200
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	config, err := Parse([]byte(fmt.Sprintf(`
+format: json
+outputs: [{type: file, path: %q}]
+hooks: [time, seq]
+`, path)), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a registry of its own, for the sequence to start at 1
+	loggers, err := newDefault().Build(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				loggers.Logger().Infoln("mylog")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := loggers.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		if want := fmt.Sprintf(`"seq":%d}`, i+1); !strings.Contains(line, want) {
+			t.Fatalf("line %d: want %s in %s", i+1, want, line)
+		}
+	}
+}
+
+// exclusiveWriter counts the writes overlapping,
+// made while another one is in progress
+type exclusiveWriter struct {
+	mu          sync.Mutex
+	writing     bool
+	overlapping int
+}
+
+func (w *exclusiveWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.writing {
+		w.overlapping++
+	}
+	w.writing = true
+	w.mu.Unlock()
+
+	time.Sleep(10 * time.Microsecond)
+
+	w.mu.Lock()
+	w.writing = false
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func TestBuild_sharedOutput(t *testing.T) {
+	w := &exclusiveWriter{}
+	r := NewRegistry()
+	r.RegisterFormat("text", func(o *Options) (genelog.Format, error) {
+		return newText(false, ""), nil
+	})
+	r.RegisterSink("exclusive", func(o *Options) (io.Writer, error) {
+		return w, nil
+	})
+
+	// the root and the module build their own pipeline
+	// on the same output
+	config := &Config{
+		Format:  Plugin{Type: "text"},
+		Outputs: []Output{{Plugin: Plugin{Type: "exclusive"}}},
+		Modules: map[string]Module{
+			"db": {Format: &Plugin{Type: "text"}},
+		},
+	}
+	loggers, err := r.Build(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logger := loggers.Logger()
+			if i%2 == 0 {
+				logger = loggers.Module("db")
+			}
+			for j := 0; j < 100; j++ {
+				logger.Infoln("entry")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if w.overlapping != 0 {
+		t.Fatalf("%d overlapping writes", w.overlapping)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	r := NewRegistry()
+	r.RegisterFormat("upper", func(o *Options) (genelog.Format, error) {
+		prefix := o.String("prefix", "")
+		return func(v interface{}, msg string) (string, error) {
+			return prefix + strings.ToUpper(msg), nil
+		}, nil
+	})
+	r.RegisterSink("buffer", func(o *Options) (io.Writer, error) {
+		return &buf, nil
+	})
+	r.RegisterHook("exclaim", func(o *Options) (genelog.Hook, error) {
+		n := o.Int("count", 1)
+		return func(v interface{}, msg string) (interface{}, string, error) {
+			return v, msg + strings.Repeat("!", n), nil
+		}, nil
+	})
+
+	loggers, err := r.Build(&Config{
+		Format:  Plugin{Type: "upper", Options: map[string]interface{}{"prefix": "> "}},
+		Outputs: []Output{{Plugin: Plugin{Type: "buffer"}}},
+		Hooks:   []Plugin{{Type: "exclaim", Options: map[string]interface{}{"count": 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggers.Logger().Infoln("hello")
+	if want := "> HELLO!!\n"; buf.String() != want {
+		t.Fatalf("want: %q, got: %q", want, buf.String())
+	}
+
+	// the types of the Default registry are not known
+	_, err = r.Build(&Config{Format: Plugin{Type: "json"}})
+	if err == nil {
+		t.Fatal("want unknown type error")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("TEST_LEVEL", "debug")
+	t.Setenv("TEST_OUTPUTS", "stderr, file?path=/tmp/app.log&level=warning")
+	t.Setenv("TEST_HOOKS", "time,redact?keys=pin&keys=cvv")
+	t.Setenv("TEST_LEVELS", "db=error,http.client=warning")
+
+	config := &Config{Level: "info", Modules: map[string]Module{"db": {Format: &Plugin{Type: "text"}}}}
+	if err := LoadEnv(config, "TEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Level != "debug" {
+		t.Fatalf("%s: level not overridden", config.Level)
+	}
+	if len(config.Outputs) != 2 || config.Outputs[1].Level != "warning" || config.Outputs[1].Options["path"] != "/tmp/app.log" {
+		t.Fatalf("%+v: wrong outputs", config.Outputs)
+	}
+	if keys, ok := config.Hooks[1].Options["keys"].([]interface{}); !ok || len(keys) != 2 {
+		t.Fatalf("%+v: wrong hooks", config.Hooks)
+	}
+	if db := config.Modules["db"]; db.Level != "error" || db.Format == nil {
+		t.Fatalf("%+v: wrong db module", db)
+	}
+	if config.Modules["http.client"].Level != "warning" {
+		t.Fatalf("%+v: wrong modules", config.Modules)
+	}
+
+	t.Setenv("TEST_LEVELS", "db=loud")
+	err := LoadEnv(config, "TEST")
+	var keyErr *KeyError
+	if !errors.As(err, &keyErr) || keyErr.Key != "TEST_LEVELS" {
+		t.Fatalf("want TEST_LEVELS error, got: %v", err)
+	}
+}
+
+func TestContext_MarshalJSON(t *testing.T) {
+	context := NewContext(level.INFO, "db")
+	context.LevelSet(level.WARNING)
+	context.CallerSet("main.go", 12)
+
+	b, err := context.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"level":"warning","module":"db","file":"main.go","line":12}`
+	if string(b) != want {
+		t.Fatalf("want: %s, got: %s", want, b)
+	}
+}
+
+func TestHandle_Reload(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+
+	handle, err := NewHandle(&Config{
+		Format:  Plugin{Type: "text"},
+		Outputs: []Output{{Plugin: Plugin{Type: "file", Options: map[string]interface{}{"path": first}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	// a child logger created before the reload
+	child := handle.Module("db").AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+		return v, "child: " + msg, nil
+	})
+
+	child.Debugln("hidden")
+	child.Infoln("before")
+
+	err = handle.Reload(&Config{
+		Level:   "debug",
+		Format:  Plugin{Type: "json"},
+		Outputs: []Output{{Plugin: Plugin{Type: "file", Options: map[string]interface{}{"path": second}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child.Debugln("after")
+
+	// an invalid configuration keeps the current one
+	if err := handle.Reload(&Config{Format: Plugin{Type: "xml"}}); err == nil {
+		t.Fatal("want an error")
+	}
+	handle.Logger().Infoln("kept")
+
+	testSuite := map[string]string{
+		first: "info [db] child: before\n",
+		second: `{"context":{"level":"debug","module":"db"},"message":"child: after"}` + "\n" +
+			`{"context":{"level":"info"},"message":"kept"}` + "\n",
+	}
+	for path, want := range testSuite {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("%s: want: %q, got: %q", filepath.Base(path), want, string(b))
+		}
+	}
+}
+
+func TestHandle_Reload_seq(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+
+	r := newDefault()
+	r.RegisterFormat("seq", func(o *Options) (genelog.Format, error) {
+		return func(v interface{}, msg string) (string, error) {
+			return fmt.Sprintf("%s %d", msg, v.(Context).Seq()), nil
+		}, nil
+	})
+	newConfig := func(path string) *Config {
+		return &Config{
+			Format:  Plugin{Type: "seq"},
+			Outputs: []Output{{Plugin: Plugin{Type: "file", Options: map[string]interface{}{"path": path}}}},
+			Hooks:   []Plugin{{Type: "seq"}},
+		}
+	}
+
+	handle, err := r.NewHandle(newConfig(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	// the sequence goes on after the reload
+	logger := handle.Logger()
+	logger.Infoln("a")
+	logger.Infoln("b")
+	if err := handle.Reload(newConfig(second)); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infoln("c")
+
+	testSuite := map[string]string{
+		first:  "a 1\nb 2\n",
+		second: "c 3\n",
+	}
+	for path, want := range testSuite {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("%s: want: %q, got: %q", filepath.Base(path), want, string(b))
+		}
+	}
+}
+
+// closingWriter counts the entries written, and the ones lost
+// being written while or after it is closed
+type closingWriter struct {
+	mu      sync.Mutex
+	closed  bool
+	written int
+	lost    int
+}
+
+func (w *closingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if !closed {
+		time.Sleep(10 * time.Microsecond)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if closed || w.closed {
+		w.lost++
+		return 0, os.ErrClosed
+	}
+	w.written++
+	return len(p), nil
+}
+
+func (w *closingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func TestHandle_Reload_concurrent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		writers []*closingWriter
+	)
+	r := NewRegistry()
+	r.RegisterFormat("text", func(o *Options) (genelog.Format, error) {
+		return newText(false, ""), nil
+	})
+	r.RegisterSink("closing", func(o *Options) (io.Writer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		w := &closingWriter{}
+		writers = append(writers, w)
+		return w, nil
+	})
+	config := &Config{
+		Format:  Plugin{Type: "text"},
+		Outputs: []Output{{Plugin: Plugin{Type: "closing"}}},
+	}
+
+	handle, err := r.NewHandle(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines, entries = 8, 200
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger := handle.Logger()
+			for j := 0; j < entries; j++ {
+				logger.Infoln("entry")
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for reloading := true; reloading; {
+		select {
+		case <-done:
+			reloading = false
+		default:
+			if err := handle.Reload(config); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := handle.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	written, lost := 0, 0
+	for _, w := range writers {
+		written += w.written
+		lost += w.lost
+	}
+	if lost != 0 || written != goroutines*entries {
+		t.Fatalf("want: %d written, got: %d written, %d lost in %d reloads",
+			goroutines*entries, written, lost, len(writers)-1)
+	}
+}
+
+func TestHandle_WatchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	output := filepath.Join(dir, "app.log")
+
+	write := func(level string) {
+		doc := fmt.Sprintf("level: %s\nformat: text\noutputs: [{type: file, path: %q}]\n", level, output)
+		if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("info")
+
+	config, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle, err := NewHandle(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	errs := make(chan error, 1)
+	if err := handle.WatchFile(path, 5*time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := handle.Logger()
+	write("warning")
+
+	// info entries are written until the reload
+	size := 0
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		logger.Infoln("info")
+		b, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) == size {
+			break
+		}
+		size = len(b)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	logger.Warningln("reloaded")
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix("\n"+string(b), "\nwarning reloaded\n") {
+		t.Fatalf("%q: configuration not reloaded", string(b))
+	}
+
+	// an invalid file is reported
+	if err := os.WriteFile(path, []byte("level: loud\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		var keyErr *KeyError
+		if !errors.As(err, &keyErr) || keyErr.Key != "level" {
+			t.Fatalf("want level error, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("invalid file not reported")
+	}
+}
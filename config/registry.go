@@ -0,0 +1,593 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/caller"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/seq"
+	libtime "github.com/6prod/genelog/field/time"
+	"github.com/6prod/genelog/format/json"
+	"github.com/6prod/genelog/hook/ratelimit"
+	"github.com/6prod/genelog/hook/redact"
+	"github.com/6prod/genelog/hook/sample"
+	"github.com/6prod/genelog/sink/journald"
+	"github.com/6prod/genelog/sink/net"
+	"github.com/6prod/genelog/sink/syslog"
+)
+
+// FormatFactory returns the format of a type from its options
+type FormatFactory func(options *Options) (genelog.Format, error)
+
+// SinkFactory returns the writer of an output type from its options.
+//
+// Writers implementing io.Closer are closed by Loggers.Close.
+type SinkFactory func(options *Options) (io.Writer, error)
+
+// HookFactory returns the hook of a type from its options
+type HookFactory func(options *Options) (genelog.Hook, error)
+
+// Registry maps the types of a configuration to their factories
+type Registry struct {
+	mu      sync.RWMutex
+	formats map[string]FormatFactory
+	sinks   map[string]SinkFactory
+	hooks   map[string]HookFactory
+	// ordered lists the hook types added to the loggers
+	// with AddOrderedHook
+	ordered map[string]bool
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		formats: make(map[string]FormatFactory),
+		sinks:   make(map[string]SinkFactory),
+		hooks:   make(map[string]HookFactory),
+		ordered: make(map[string]bool),
+	}
+}
+
+// Default is the registry of Build, with the types of genelog:
+//
+//	formats: json, text, message, syslog, journald
+//	outputs: stdout, stderr, discard, file, syslog, journald, net
+//	hooks:   time, caller, seq, ulid, redact, sample, ratelimit
+//
+// The seq hooks share one counter: the sequence numbers go on
+// across the loggers built, and across the reloads of a Handle.
+var Default = newDefault()
+
+// RegisterFormat adds a format type, replacing any previous one
+func (r *Registry) RegisterFormat(name string, factory FormatFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.formats[name] = factory
+}
+
+// RegisterSink adds an output type, replacing any previous one
+func (r *Registry) RegisterSink(name string, factory SinkFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks[name] = factory
+}
+
+// RegisterHook adds a hook type, replacing any previous one
+func (r *Registry) RegisterHook(name string, factory HookFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[name] = factory
+	delete(r.ordered, name)
+}
+
+// RegisterOrderedHook adds a hook type added to the loggers with
+// genelog.Logger.AddOrderedHook, replacing any previous one.
+//
+// As the contexts of the configurations are copied for each entry,
+// the hooks run concurrently, and the entries are written in the order
+// they go through an ordered hook, as needed by sequence numbers.
+func (r *Registry) RegisterOrderedHook(name string, factory HookFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[name] = factory
+	r.ordered[name] = true
+}
+
+// RegisterFormat adds a format type to the Default registry
+func RegisterFormat(name string, factory FormatFactory) {
+	Default.RegisterFormat(name, factory)
+}
+
+// RegisterSink adds an output type to the Default registry
+func RegisterSink(name string, factory SinkFactory) {
+	Default.RegisterSink(name, factory)
+}
+
+// RegisterHook adds a hook type to the Default registry
+func RegisterHook(name string, factory HookFactory) {
+	Default.RegisterHook(name, factory)
+}
+
+// RegisterOrderedHook adds an ordered hook type to the Default registry
+func RegisterOrderedHook(name string, factory HookFactory) {
+	Default.RegisterOrderedHook(name, factory)
+}
+
+func (r *Registry) format(key string, plugin Plugin) (genelog.Format, error) {
+	r.mu.RLock()
+	factory, ok := r.formats[plugin.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, unknownType(key, "format", plugin.Type)
+	}
+
+	options := newOptions(key, plugin.Options)
+	format, err := factory(options)
+	if err := options.check(err); err != nil {
+		return nil, err
+	}
+	return format, nil
+}
+
+func (r *Registry) sink(key string, plugin Plugin) (io.Writer, error) {
+	r.mu.RLock()
+	factory, ok := r.sinks[plugin.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, unknownType(key, "output", plugin.Type)
+	}
+
+	options := newOptions(key, plugin.Options)
+	w, err := factory(options)
+	if err := options.check(err); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// hook returns the hook of plugin, and true if it is ordered
+func (r *Registry) hook(key string, plugin Plugin) (genelog.Hook, bool, error) {
+	r.mu.RLock()
+	factory, ok := r.hooks[plugin.Type]
+	ordered := r.ordered[plugin.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false, unknownType(key, "hook", plugin.Type)
+	}
+
+	options := newOptions(key, plugin.Options)
+	hook, err := factory(options)
+	if err := options.check(err); err != nil {
+		return nil, false, err
+	}
+	return hook, ordered, nil
+}
+
+func unknownType(key, kind, name string) error {
+	if name == "" {
+		return &KeyError{join(key, "type"), ErrMissingKey}
+	}
+	return &KeyError{join(key, "type"), fmt.Errorf("%s: unknown %s type", name, kind)}
+}
+
+// Options are the options of a type, read by its factory.
+//
+// The getters return the default value of an option not set. The
+// first invalid option is reported by Err, and the options not
+// read by the factory are reported as unknown keys.
+type Options struct {
+	key    string
+	values map[string]interface{}
+	used   map[string]bool
+	err    error
+}
+
+func newOptions(key string, values map[string]interface{}) *Options {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	return &Options{
+		key:    key,
+		values: values,
+		used:   make(map[string]bool),
+	}
+}
+
+// Err returns the first invalid option
+func (o *Options) Err() error {
+	return o.err
+}
+
+// check returns the error of a factory or an option
+func (o *Options) check(err error) error {
+	if err != nil {
+		var keyErr *KeyError
+		if errors.As(err, &keyErr) {
+			return err
+		}
+		return &KeyError{o.key, err}
+	}
+	if o.err != nil {
+		return o.err
+	}
+
+	names := make([]string, 0)
+	for name := range o.values {
+		if !o.used[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return &KeyError{join(o.key, names[0]), ErrUnknownKey}
+	}
+	return nil
+}
+
+func (o *Options) get(name string) (interface{}, bool) {
+	o.used[name] = true
+	v, ok := o.values[name]
+	return v, ok && v != nil
+}
+
+func (o *Options) fail(name string, err error) {
+	if o.err == nil {
+		o.err = &KeyError{join(o.key, name), err}
+	}
+}
+
+// String returns the option name as a string
+func (o *Options) String(name, def string) string {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v
+	case int, float64, bool:
+		return fmt.Sprint(v)
+	}
+	o.fail(name, fmt.Errorf("want a string, got %T", v))
+	return def
+}
+
+// Required returns the option name as a string,
+// reporting an error if it's not set
+func (o *Options) Required(name string) string {
+	if _, ok := o.values[name]; !ok {
+		o.used[name] = true
+		o.fail(name, ErrMissingKey)
+		return ""
+	}
+	return o.String(name, "")
+}
+
+// Int returns the option name as an integer
+func (o *Options) Int(name string, def int) int {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	switch v := v.(type) {
+	case int:
+		return v
+	case float64:
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	o.fail(name, fmt.Errorf("%v: want an integer", v))
+	return def
+}
+
+// Float returns the option name as a float
+func (o *Options) Float(name string, def float64) float64 {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	o.fail(name, fmt.Errorf("%v: want a number", v))
+	return def
+}
+
+// Bool returns the option name as a boolean
+func (o *Options) Bool(name string, def bool) bool {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	o.fail(name, fmt.Errorf("%v: want a boolean", v))
+	return def
+}
+
+// Duration returns the option name as a duration, like "1m30s"
+func (o *Options) Duration(name string, def time.Duration) time.Duration {
+	s := o.String(name, "")
+	if s == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		o.fail(name, err)
+		return def
+	}
+	return d
+}
+
+// Strings returns the option name as a list of strings.
+// A single string is a list of one.
+func (o *Options) Strings(name string, def []string) []string {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	if s, ok := v.(string); ok {
+		return []string{s}
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		o.fail(name, fmt.Errorf("want a list, got %T", v))
+		return def
+	}
+
+	strs := make([]string, 0, len(list))
+	for i, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			o.fail(index(name, i), fmt.Errorf("want a string, got %T", v))
+			return def
+		}
+		strs = append(strs, s)
+	}
+	return strs
+}
+
+// Level returns the option name as a level
+func (o *Options) Level(name string, def level.Level) level.Level {
+	s := o.String(name, "")
+	if s == "" {
+		return def
+	}
+
+	l, ok := level.NewLevelFromString(s)
+	if !ok {
+		o.fail(name, fmt.Errorf("%s: unknown level", s))
+		return def
+	}
+	return l
+}
+
+// writer hides the Close method of the standard outputs
+type writer struct {
+	io.Writer
+}
+
+func newDefault() *Registry {
+	r := NewRegistry()
+
+	r.RegisterFormat("json", func(o *Options) (genelog.Format, error) {
+		return json.JSON, nil
+	})
+	r.RegisterFormat("text", func(o *Options) (genelog.Format, error) {
+		return newText(o.Bool("color", false), o.String("time_format", time.RFC3339)), nil
+	})
+	r.RegisterFormat("message", func(o *Options) (genelog.Format, error) {
+		return func(v interface{}, msg string) (string, error) {
+			return msg, nil
+		}, nil
+	})
+	r.RegisterFormat("syslog", func(o *Options) (genelog.Format, error) {
+		protocol := syslog.RFC5424
+		switch p := o.String("protocol", "rfc5424"); strings.ToLower(p) {
+		case "rfc5424":
+		case "rfc3164":
+			protocol = syslog.RFC3164
+		default:
+			o.fail("protocol", fmt.Errorf("%s: unknown syslog protocol", p))
+		}
+
+		facility, ok := syslogFacilities[strings.ToLower(o.String("facility", "user"))]
+		if !ok {
+			o.fail("facility", errors.New("unknown syslog facility"))
+		}
+
+		formatter := syslog.NewFormatter(protocol, facility, o.String("app", filepath.Base(os.Args[0])))
+		if hostname := o.String("hostname", ""); hostname != "" {
+			formatter = formatter.WithHostname(hostname)
+		}
+		if msgID := o.String("msgid", ""); msgID != "" {
+			formatter = formatter.WithMsgID(msgID)
+		}
+		return formatter.Format, nil
+	})
+	r.RegisterFormat("journald", func(o *Options) (genelog.Format, error) {
+		return journald.NewFormatter(o.String("identifier", filepath.Base(os.Args[0]))).Format, nil
+	})
+
+	r.RegisterSink("stdout", func(o *Options) (io.Writer, error) {
+		return writer{os.Stdout}, nil
+	})
+	r.RegisterSink("stderr", func(o *Options) (io.Writer, error) {
+		return writer{os.Stderr}, nil
+	})
+	r.RegisterSink("discard", func(o *Options) (io.Writer, error) {
+		return io.Discard, nil
+	})
+	r.RegisterSink("file", func(o *Options) (io.Writer, error) {
+		path := o.Required("path")
+		perm := o.Int("perm", 0o644)
+		if o.Err() != nil {
+			return nil, nil
+		}
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(perm))
+	})
+	r.RegisterSink("syslog", func(o *Options) (io.Writer, error) {
+		framing := syslog.OctetCounting
+		switch f := o.String("framing", "octet-counting"); f {
+		case "octet-counting":
+		case "non-transparent":
+			framing = syslog.NonTransparent
+		default:
+			o.fail("framing", fmt.Errorf("%s: unknown framing", f))
+		}
+		network, address := o.String("network", ""), o.String("address", "")
+		if o.Err() != nil {
+			return nil, nil
+		}
+
+		w, err := syslog.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		return w.WithFraming(framing), nil
+	})
+	r.RegisterSink("journald", func(o *Options) (io.Writer, error) {
+		path := o.String("path", "")
+		if o.Err() != nil {
+			return nil, nil
+		}
+		return journald.Dial(path)
+	})
+	r.RegisterSink("net", func(o *Options) (io.Writer, error) {
+		framing := net.Newline
+		switch f := o.String("framing", "newline"); f {
+		case "newline":
+		case "length-prefix":
+			framing = net.LengthPrefix
+		default:
+			o.fail("framing", fmt.Errorf("%s: unknown framing", f))
+		}
+
+		w := net.New(o.String("network", "tcp"), o.Required("address")).
+			WithFraming(framing)
+		if size := o.Int("buffer", 0); size > 0 {
+			w = w.WithBuffer(size)
+		}
+		if timeout := o.Duration("dial_timeout", 0); timeout > 0 {
+			w = w.WithDialTimeout(timeout)
+		}
+		return w, nil
+	})
+
+	r.RegisterHook("time", func(o *Options) (genelog.Hook, error) {
+		return libtime.HookUpdateTime, nil
+	})
+	r.RegisterHook("caller", func(o *Options) (genelog.Hook, error) {
+		return caller.HookCaller, nil
+	})
+	// the counter shared by the seq hooks
+	counter := new(uint64)
+	r.RegisterOrderedHook("seq", func(o *Options) (genelog.Hook, error) {
+		return seq.NewHookSeqCounter(counter), nil
+	})
+	r.RegisterHook("ulid", func(o *Options) (genelog.Hook, error) {
+		return seq.HookULID, nil
+	})
+	r.RegisterHook("redact", func(o *Options) (genelog.Hook, error) {
+		redactor := redact.New()
+		if o.Bool("default_rules", true) {
+			redactor = redactor.WithRules(redact.DefaultRules...)
+		}
+		if o.Bool("default_keys", true) {
+			redactor = redactor.WithKeys(redact.DefaultKeys...)
+		}
+		redactor = redactor.WithKeys(o.Strings("keys", nil)...)
+		for i, pattern := range o.Strings("patterns", nil) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				o.fail(index("patterns", i), err)
+				continue
+			}
+			redactor = redactor.WithPatterns(re)
+		}
+		if mask := o.String("mask", ""); mask != "" {
+			redactor = redactor.WithMask(redact.MaskFixed(mask))
+		}
+		return redactor.Hook, nil
+	})
+	r.RegisterHook("sample", func(o *Options) (genelog.Hook, error) {
+		first := o.Int("first", 100)
+		thereafter := o.Int("thereafter", 100)
+		if first < 0 || thereafter < 0 {
+			return nil, errors.New("first and thereafter must be positive")
+		}
+		return sample.New(uint64(first), uint64(thereafter), o.Duration("tick", time.Second)).Hook, nil
+	})
+	r.RegisterHook("ratelimit", func(o *Options) (genelog.Hook, error) {
+		rate := o.Float("rate", 0)
+		burst := o.Int("burst", 1)
+		if rate <= 0 {
+			o.fail("rate", errors.New("must be positive"))
+		}
+		if o.Bool("per_message", false) {
+			return ratelimit.NewPerKey(rate, burst, ratelimit.KeyMessage).Hook, nil
+		}
+		return ratelimit.New(rate, burst).Hook, nil
+	})
+
+	return r
+}
+
+var syslogFacilities = map[string]syslog.Facility{
+	"kern":     syslog.KERN,
+	"user":     syslog.USER,
+	"mail":     syslog.MAIL,
+	"daemon":   syslog.DAEMON,
+	"auth":     syslog.AUTH,
+	"syslog":   syslog.SYSLOG,
+	"lpr":      syslog.LPR,
+	"news":     syslog.NEWS,
+	"uucp":     syslog.UUCP,
+	"cron":     syslog.CRON,
+	"authpriv": syslog.AUTHPRIV,
+	"ftp":      syslog.FTP,
+	"local0":   syslog.LOCAL0,
+	"local1":   syslog.LOCAL1,
+	"local2":   syslog.LOCAL2,
+	"local3":   syslog.LOCAL3,
+	"local4":   syslog.LOCAL4,
+	"local5":   syslog.LOCAL5,
+	"local6":   syslog.LOCAL6,
+	"local7":   syslog.LOCAL7,
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// ErrClosed is returned when reloading a closed handle
+var ErrClosed = errors.New("config: handle closed")
+
+// Handle is a logger tree reloadable without restart.
+//
+// The loggers of a handle route their entries to the current
+// configuration, so that Reload changes the writers, formats,
+// hooks and levels of all of them, including the loggers derived
+// with WithContext or AddHook.
+//
+// The minimum level is applied by the routing: the contexts of the
+// loggers of a handle have no minimum level set.
+type Handle struct {
+	registry *Registry
+	// mu serializes Reload and Close
+	mu sync.Mutex
+	// current guards loggers, swapped by Reload
+	// while the entries are routed
+	current sync.RWMutex
+	loggers *Loggers
+	// writing counts the entries in progress
+	// to loggers, waited for before closing it
+	writing *sync.WaitGroup
+	closed  bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewHandle returns a handle built with the Default registry
+func NewHandle(config *Config) (*Handle, error) {
+	return Default.NewHandle(config)
+}
+
+// NewHandle returns a handle built from config
+func (r *Registry) NewHandle(config *Config) (*Handle, error) {
+	loggers, err := r.Build(config)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Handle{
+		registry: r,
+		loggers:  loggers,
+		writing:  &sync.WaitGroup{},
+		stop:     make(chan struct{}),
+	}
+	return h, nil
+}
+
+// acquire returns the current configuration and a function
+// to call once done writing to it
+func (h *Handle) acquire() (*Loggers, func()) {
+	h.current.RLock()
+	defer h.current.RUnlock()
+
+	h.writing.Add(1)
+	return h.loggers, h.writing.Done
+}
+
+// swap replaces the current configuration with loggers, if not nil,
+// then waits for the entries in progress to the previous one
+func (h *Handle) swap(loggers *Loggers) *Loggers {
+	h.current.Lock()
+	previous, writing := h.loggers, h.writing
+	if loggers != nil {
+		h.loggers = loggers
+	}
+	// the entries acquiring after the swap are not waited for
+	h.writing = &sync.WaitGroup{}
+	h.current.Unlock()
+
+	writing.Wait()
+	return previous
+}
+
+// Logger returns a root logger with a new context
+func (h *Handle) Logger() level.LevelLogger {
+	return h.Module("")
+}
+
+// Module returns a logger of module name with a new context,
+// configured like Loggers.Module by the current configuration
+func (h *Handle) Module(name string) level.LevelLogger {
+	logger := genelog.RouteRelease(func() (*genelog.Logger, func()) {
+		loggers, release := h.acquire()
+		return loggers.lookup(name).routed, release
+	})
+	return level.LevelLogger{Logger: logger.WithContext(NewContext(level.UNSET, name))}
+}
+
+// Reload builds config and swaps it with the current configuration,
+// then closes the writers of the previous one once the entries
+// in progress are written.
+//
+// On error, the current configuration is kept. Reload must not be
+// called by the hooks or writers of the loggers of the handle,
+// waiting for their entries.
+func (h *Handle) Reload(config *Config) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrClosed
+	}
+
+	loggers, err := h.registry.Build(config)
+	if err != nil {
+		return err
+	}
+
+	return h.swap(loggers).Close()
+}
+
+// WatchFile reloads the configuration file at path when its
+// modification time or size changes, checked every interval.
+//
+// Errors loading or building the file are passed to onError if not
+// nil, the current configuration being kept. Watching stops when
+// the handle is closed.
+func (h *Handle) WatchFile(path string, interval time.Duration, onError func(error)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		modTime, size := info.ModTime(), info.Size()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				report(onError, err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+
+			config, err := LoadFile(path)
+			if err != nil {
+				report(onError, err)
+				continue
+			}
+			if err := h.Reload(config); err != nil && !errors.Is(err, ErrClosed) {
+				report(onError, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func report(onError func(error), err error) {
+	if onError != nil {
+		onError(err)
+	}
+}
+
+// Close stops watching and closes the writers of the current
+// configuration once the entries in progress are written
+func (h *Handle) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.stop)
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	return h.swap(nil).Close()
+}
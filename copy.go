@@ -0,0 +1,113 @@
+package genelog
+
+import (
+	"reflect"
+	"time"
+)
+
+// Copier is implemented by the contexts and the context fields
+// copied before each entry.
+//
+// The hooks and the formatter run concurrently on the copies, only
+// the write being serialized, from the first hook added with
+// AddOrderedHook if any. The entries of the contexts that can't be
+// copied, see CopyContext, are serialized from the first hook to
+// the write.
+type Copier interface {
+	Copy() interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// CopyContext returns a copy of context for an entry, and true if
+// the copy shares no value the hooks could change with context.
+//
+// Contexts implementing Copier are copied with Copy, if it returns
+// a value of their type and not of an embedded field. Structs are
+// copied with their pointer fields copied with Copy, like the
+// fields of the field packages. Values without references, like
+// strings and numbers, are returned as is. The other contexts, like
+// pointers and structs with maps, slices or pointers not
+// implementing Copier, are returned as is with false.
+func CopyContext(context interface{}) (interface{}, bool) {
+	if context == nil {
+		return nil, true
+	}
+
+	v := reflect.ValueOf(context)
+	if copier, ok := context.(Copier); ok {
+		// the method may be promoted from an embedded field
+		if copied := callCopy(copier); reflect.TypeOf(copied) == v.Type() {
+			return copied, true
+		}
+	}
+	if isValue(v.Type()) {
+		return context, true
+	}
+	if v.Kind() != reflect.Struct {
+		return context, false
+	}
+
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	for i := 0; i < copied.NumField(); i++ {
+		field := copied.Field(i)
+		if isValue(field.Type()) {
+			continue
+		}
+		if field.Kind() != reflect.Ptr || !field.CanSet() {
+			return context, false
+		}
+		if field.IsNil() {
+			continue
+		}
+
+		copier, ok := field.Interface().(Copier)
+		if !ok {
+			return context, false
+		}
+		fieldCopy := reflect.ValueOf(copier.Copy())
+		if !fieldCopy.IsValid() || !fieldCopy.Type().AssignableTo(field.Type()) {
+			return context, false
+		}
+		field.Set(fieldCopy)
+	}
+	return copied.Interface(), true
+}
+
+// callCopy calls Copy, returning nil if it panics like the
+// methods promoted from nil embedded fields
+func callCopy(copier Copier) (copied interface{}) {
+	defer func() {
+		if recover() != nil {
+			copied = nil
+		}
+	}()
+	return copier.Copy()
+}
+
+// isValue returns true for the types without references,
+// copied by assignment
+func isValue(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isValue(t.Elem())
+	case reflect.Struct:
+		// the location of a time is not changed
+		if t == timeType {
+			return true
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if !isValue(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+// Package caller adds the file and line of the logging call
+// to the context.
+package caller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+type WithCaller struct {
+	file string
+	line int
+}
+
+// withCallerJSON is an helper structure
+// to decode json from WithCaller with
+// private attributes
+type withCallerJSON struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+func NewWithCaller() *WithCaller {
+	return &WithCaller{}
+}
+
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithCaller) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
+func (w WithCaller) Caller() (file string, line int) {
+	return w.file, w.line
+}
+
+func (w *WithCaller) CallerSet(file string, line int) {
+	w.file = file
+	w.line = line
+}
+
+func (w WithCaller) MarshalJSON() ([]byte, error) {
+	return json.Marshal(withCallerJSON{File: w.file, Line: w.line})
+}
+
+func (w *WithCaller) UnmarshalJSON(b []byte) error {
+	if w == nil {
+		return errors.New("logger: json decoder: WithCaller is nil")
+	}
+
+	var withCaller withCallerJSON
+	if err := json.Unmarshal(b, &withCaller); err != nil {
+		return err
+	}
+
+	w.file = withCaller.File
+	w.line = withCaller.Line
+
+	return nil
+}
+
+// Caller is the interface to access the caller field
+type Caller interface {
+	Caller() (file string, line int)
+	CallerSet(file string, line int)
+}
+
+// SkipPackages lists the packages whose frames are skipped to find
+// the logging call. Packages wrapping the logger can be added.
+var SkipPackages = []string{
+	"github.com/6prod/genelog",
+	"github.com/6prod/genelog/field/level",
+	"github.com/6prod/genelog/field/caller",
+	"github.com/6prod/genelog/hook",
+	"github.com/6prod/genelog/stdlog",
+	"log",
+}
+
+// maxDepth is the maximum number of frames inspected
+const maxDepth = 32
+
+// HookCaller sets the file and line of the logging call
+func HookCaller(v interface{}, msg string) (interface{}, string, error) {
+	context, ok := v.(Caller)
+	if !ok {
+		return nil, "", fmt.Errorf("%T: not implementing the Caller interface", v)
+	}
+
+	file, line := Find()
+	context.CallerSet(file, line)
+
+	return context, msg, nil
+}
+
+// Find returns the file and line of the first frame
+// outside of SkipPackages
+func Find() (file string, line int) {
+	pc := make([]uintptr, maxDepth)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !skip(frame) {
+			return frame.File, frame.Line
+		}
+		if !more {
+			return "", 0
+		}
+	}
+}
+
+// skip returns true for frames of SkipPackages,
+// test files excluded
+func skip(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+
+	pkg := packageName(frame.Function)
+	if strings.HasPrefix(pkg, "runtime") {
+		return true
+	}
+	for _, p := range SkipPackages {
+		if pkg == p {
+			return true
+		}
+	}
+	return false
+}
+
+// packageName returns the package path of a function name
+// such as github.com/6prod/genelog.(*Logger).write
+func packageName(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
@@ -0,0 +1,97 @@
+package caller
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+type exampleWithCaller struct {
+	*WithCaller
+}
+
+func TestHookCaller(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	context := exampleWithCaller{
+		NewWithCaller(),
+	}
+
+	logger := genelog.New(&buf).
+		WithContext(context).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			context, ok := v.(Caller)
+			if !ok {
+				return "", fmt.Errorf("%T: not Caller type", v)
+			}
+			file, line := context.Caller()
+			return fmt.Sprintf("%s:%d %s", filepath.Base(file), line, msg), nil
+		}).
+		AddHook(HookCaller)
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Println("mylog")
+
+	if want, got := fmt.Sprintf("caller_test.go:%d mylog\n", line+1), buf.String(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+type exampleContext struct {
+	*level.WithLevel
+	*WithCaller
+}
+
+func TestHookCaller_levelLogger(t *testing.T) {
+	context := exampleContext{
+		level.NewWithLevel(level.DEBUG),
+		NewWithCaller(),
+	}
+
+	buf := bytes.Buffer{}
+	logger := level.NewLevelLogger(&buf).
+		WithContext(context).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			file, line := v.(exampleContext).Caller()
+			return fmt.Sprintf("%s:%d", filepath.Base(file), line), nil
+		}).
+		AddHook(HookCaller)
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Info("mylog")
+
+	if want, got := fmt.Sprintf("caller_test.go:%d", line+1), buf.String(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	// the hook sets the caller on a copy of the context
+	if file, _ := context.Caller(); file != "" {
+		t.Fatalf("context updated: %s", file)
+	}
+}
+
+func TestWithCaller_JSON(t *testing.T) {
+	w := NewWithCaller()
+	w.CallerSet("main.go", 12)
+
+	b, err := w.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"file":"main.go","line":12}`; string(b) != want {
+		t.Fatalf("want: %s, got: %s", want, b)
+	}
+
+	got := NewWithCaller()
+	if err := got.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	if file, line := got.Caller(); file != "main.go" || line != 12 {
+		t.Fatalf("want: main.go:12, got: %s:%d", file, line)
+	}
+}
@@ -120,6 +120,13 @@ func NewWithLevel(min Level) *WithLevel {
 	}
 }
 
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithLevel) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
 func (w WithLevel) Level() Level {
 	return w.level
 }
@@ -140,6 +147,24 @@ func (w WithLevel) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// UnmarshalJSON decodes the level, the minimum level is left unchanged
+func (w *WithLevel) UnmarshalJSON(b []byte) error {
+	if w == nil {
+		return errors.New("logger: json decoder: WithLevel is nil")
+	}
+
+	var withLevel struct {
+		Level Level `json:"level"`
+	}
+	if err := json.Unmarshal(b, &withLevel); err != nil {
+		return err
+	}
+
+	w.level = withLevel.Level
+
+	return nil
+}
+
 // Leveler is the interface to access the level field
 type Leveler interface {
 	// LevelMin returns the minimum level to print
@@ -170,3 +195,20 @@ func HookLevelSkip(v interface{}, msg string) (interface{}, string, error) {
 	}
 	return v, msg, nil
 }
+
+// NewHookLevelMin returns a hook skipping entries below min,
+// regardless of the minimum level of the context.
+//
+// It sets a minimum level per Tee branch.
+func NewHookLevelMin(min Level) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := v.(Leveler)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Leveler interface", v)
+		}
+		if !IsActive(min, context.Level()) {
+			return v, msg, genelog.ErrSkip
+		}
+		return v, msg, nil
+	}
+}
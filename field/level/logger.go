@@ -119,6 +119,46 @@ func (l LevelLogger) AddHook(h genelog.Hook) LevelLogger {
 	return LevelLogger{logger}
 }
 
+func (l LevelLogger) AddOrderedHook(h genelog.Hook) LevelLogger {
+	logger := l.Logger.AddOrderedHook(h)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) PrependHook(h genelog.Hook) LevelLogger {
+	logger := l.Logger.PrependHook(h)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) AddNamedHook(name string, h genelog.Hook) LevelLogger {
+	logger := l.Logger.AddNamedHook(name, h)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) InsertHookBefore(before, name string, h genelog.Hook) LevelLogger {
+	logger := l.Logger.InsertHookBefore(before, name, h)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) InsertHookAfter(after, name string, h genelog.Hook) LevelLogger {
+	logger := l.Logger.InsertHookAfter(after, name, h)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) RemoveHook(name string) LevelLogger {
+	logger := l.Logger.RemoveHook(name)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) WithQuarantine(failures int) LevelLogger {
+	logger := l.Logger.WithQuarantine(failures)
+	return LevelLogger{logger}
+}
+
+func (l LevelLogger) AddObserver(o genelog.Observer) LevelLogger {
+	logger := l.Logger.AddObserver(o)
+	return LevelLogger{logger}
+}
+
 // writerErr is an io.Writer that always returns an error
 type writerErr struct {
 	err error
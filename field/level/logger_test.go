@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"testing"
 
+	"github.com/6prod/genelog"
 	"github.com/6prod/genelog/format/json"
 )
 
@@ -64,3 +66,50 @@ func ExampleLevelLogger_Writer() {
 	// {"context":{"level":"warning"},"message":"w1"}
 	// {"context":{"level":"warning"},"message":"w1"}
 }
+
+func ExampleNewHookLevelMin() {
+	console := bytes.Buffer{}
+	file := bytes.Buffer{}
+
+	context := exampleWithLevel{
+		NewWithLevel(DEBUG),
+	}
+
+	logger := LevelLogger{
+		genelog.Tee(
+			genelog.New(&console).
+				WithFormatter(func(v interface{}, msg string) (string, error) {
+					context, _ := v.(exampleWithLevel)
+					return fmt.Sprintf("%s: %s", context.Level(), msg), nil
+				}).
+				AddHook(NewHookLevelMin(INFO)),
+			genelog.New(&file).
+				WithFormatter(json.JSON),
+		),
+	}.
+		AddHook(HookLevelSkip).
+		WithContext(context)
+
+	logger.Debugln("mylog")
+	logger.Errorln("mylog")
+
+	fmt.Print(&console)
+	fmt.Print(&file)
+	// Output:
+	// error: mylog
+	// {"context":{"level":"debug"},"message":"mylog"}
+	// {"context":{"level":"error"},"message":"mylog"}
+}
+
+func BenchmarkLevelLogger_parallel(b *testing.B) {
+	logger := NewLevelLogger(io.Discard).
+		WithFormatter(json.JSON).
+		WithContext(exampleWithLevel{NewWithLevel(DEBUG)})
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Infoln("mylog")
+		}
+	})
+}
@@ -7,110 +7,111 @@ import (
 )
 
 func Info(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, INFO, func(logger *genelog.Logger) error {
-		logger.Print(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, INFO); ok {
+		logger.PrintWith(h, v...)
+	}
 }
 
 func Infoln(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, INFO, func(logger *genelog.Logger) error {
-		logger.Println(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, INFO); ok {
+		logger.PrintlnWith(h, v...)
+	}
 }
 
 func Infof(logger *genelog.Logger, format string, v ...interface{}) {
-	_ = Output(logger, INFO, func(logger *genelog.Logger) error {
-		logger.Printf(format, v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, INFO); ok {
+		logger.PrintfWith(h, format, v...)
+	}
 }
 
 func Error(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, ERROR, func(logger *genelog.Logger) error {
-		logger.Print(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, ERROR); ok {
+		logger.PrintWith(h, v...)
+	}
 }
 
 func Errorln(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, ERROR, func(logger *genelog.Logger) error {
-		logger.Println(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, ERROR); ok {
+		logger.PrintlnWith(h, v...)
+	}
 }
 
 func Errorf(logger *genelog.Logger, format string, v ...interface{}) {
-	_ = Output(logger, ERROR, func(logger *genelog.Logger) error {
-		logger.Printf(format, v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, ERROR); ok {
+		logger.PrintfWith(h, format, v...)
+	}
 }
 
 func Debug(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, DEBUG, func(logger *genelog.Logger) error {
-		logger.Print(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, DEBUG); ok {
+		logger.PrintWith(h, v...)
+	}
 }
 
 func Debugln(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, DEBUG, func(logger *genelog.Logger) error {
-		logger.Println(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, DEBUG); ok {
+		logger.PrintlnWith(h, v...)
+	}
 }
 
 func Debugf(logger *genelog.Logger, format string, v ...interface{}) {
-	_ = Output(logger, DEBUG, func(logger *genelog.Logger) error {
-		logger.Printf(format, v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, DEBUG); ok {
+		logger.PrintfWith(h, format, v...)
+	}
 }
 
 func Warning(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, WARNING, func(logger *genelog.Logger) error {
-		logger.Print(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, WARNING); ok {
+		logger.PrintWith(h, v...)
+	}
 }
 
 func Warningln(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, WARNING, func(logger *genelog.Logger) error {
-		logger.Println(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, WARNING); ok {
+		logger.PrintlnWith(h, v...)
+	}
 }
 
 func Warningf(logger *genelog.Logger, format string, v ...interface{}) {
-	_ = Output(logger, WARNING, func(logger *genelog.Logger) error {
-		logger.Printf(format, v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, WARNING); ok {
+		logger.PrintfWith(h, format, v...)
+	}
 }
 
 func Fatal(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, FATAL, func(logger *genelog.Logger) error {
-		logger.Print(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, FATAL); ok {
+		logger.PrintWith(h, v...)
+	}
 }
 
 func Fatalln(logger *genelog.Logger, v ...interface{}) {
-	_ = Output(logger, FATAL, func(logger *genelog.Logger) error {
-		logger.Println(v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, FATAL); ok {
+		logger.PrintlnWith(h, v...)
+	}
 }
 
 func Fatalf(logger *genelog.Logger, format string, v ...interface{}) {
-	_ = Output(logger, FATAL, func(logger *genelog.Logger) error {
-		logger.Printf(format, v...)
-		return nil
-	})
+	if h, ok := hookLevel(logger, FATAL); ok {
+		logger.PrintfWith(h, format, v...)
+	}
 }
 
+// hookLevel returns the hook setting level on the entries of logger,
+// false if the level is not active or the context not a Leveler
+func hookLevel(logger *genelog.Logger, level Level) (genelog.Hook, bool) {
+	context, ok := GetLeveler(logger.Context())
+	if !ok || !IsActive(context.LevelMin(), level) {
+		return nil, false
+	}
+	return hookLevelSet(level), true
+}
+
+// Output calls output with a logger setting the level of the
+// entries in a first hook, on the copy of the context made by
+// genelog.CopyContext, or else with the entries serialized.
+//
+// The logger is cloned for each call: the print functions of the
+// package set the level without cloning it.
 func Output(logger *genelog.Logger, level Level, output func(logger *genelog.Logger) error) error {
 	context, ok := GetLeveler(logger.Context())
 	if !ok {
@@ -121,8 +122,36 @@ func Output(logger *genelog.Logger, level Level, output func(logger *genelog.Log
 		return nil
 	}
 
-	context.LevelSet(level)
-	logger = logger.WithContext(context)
+	return output(logger.PrependHook(hookLevelSet(level)))
+}
 
-	return output(logger)
+// levelSetHooks are the hooks setting the level of the entries by level
+var levelSetHooks = map[Level]genelog.Hook{
+	UNSET:   newHookLevelSet(UNSET),
+	DEBUG:   newHookLevelSet(DEBUG),
+	INFO:    newHookLevelSet(INFO),
+	WARNING: newHookLevelSet(WARNING),
+	ERROR:   newHookLevelSet(ERROR),
+	FATAL:   newHookLevelSet(FATAL),
+	OFF:     newHookLevelSet(OFF),
+}
+
+// hookLevelSet returns the hook setting level on the entries
+func hookLevelSet(level Level) genelog.Hook {
+	if h, ok := levelSetHooks[level]; ok {
+		return h
+	}
+	return newHookLevelSet(level)
+}
+
+// newHookLevelSet returns a hook setting the level of the entries
+func newHookLevelSet(level Level) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := GetLeveler(v)
+		if !ok {
+			return nil, "", fmt.Errorf("logger: %w", ErrLevelerNotImplemented)
+		}
+		context.LevelSet(level)
+		return v, msg, nil
+	}
 }
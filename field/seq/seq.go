@@ -0,0 +1,223 @@
+// Package seq stamps log entries with a sequence number and an
+// optional unique entry ID so that downstream tools can detect
+// dropped or reordered lines.
+//
+// The sequence counter lives in the hook returned by NewHookSeq,
+// or is given to NewHookSeqCounter. Clones of a logger share their
+// hooks, so every logger derived from the one the hook was added to
+// shares the same counter.
+//
+// With contexts copied by genelog.CopyContext, add the hook with
+// genelog.Logger.AddOrderedHook for the entries to be written in the
+// sequence order, the hooks running concurrently otherwise.
+package seq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/6prod/genelog"
+)
+
+type WithSeq struct {
+	seq uint64
+	id  string
+}
+
+// withSeqJSON is an helper structure
+// to decode json from WithSeq with
+// private attributes
+type withSeqJSON struct {
+	Seq uint64 `json:"seq"`
+	ID  string `json:"id,omitempty"`
+}
+
+func NewWithSeq() *WithSeq {
+	return &WithSeq{}
+}
+
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithSeq) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
+func (w WithSeq) Seq() uint64 {
+	return w.seq
+}
+
+func (w *WithSeq) SeqSet(n uint64) {
+	w.seq = n
+}
+
+func (w WithSeq) ID() string {
+	return w.id
+}
+
+func (w *WithSeq) IDSet(id string) {
+	w.id = id
+}
+
+func (w WithSeq) MarshalJSON() ([]byte, error) {
+	return json.Marshal(withSeqJSON{Seq: w.seq, ID: w.id})
+}
+
+func (w *WithSeq) UnmarshalJSON(b []byte) error {
+	if w == nil {
+		return errors.New("logger: json decoder: WithSeq is nil")
+	}
+
+	var withSeq withSeqJSON
+	if err := json.Unmarshal(b, &withSeq); err != nil {
+		return err
+	}
+
+	w.seq = withSeq.Seq
+	w.id = withSeq.ID
+
+	return nil
+}
+
+// Sequencer is the interface to access the sequence number field
+type Sequencer interface {
+	Seq() uint64
+	SeqSet(uint64)
+}
+
+// Identifier is the interface to access the entry ID field
+type Identifier interface {
+	ID() string
+	IDSet(string)
+}
+
+// NewHookSeq returns a hook setting a monotonically increasing
+// sequence number, starting at 1, on every entry.
+//
+// The counter is owned by the returned hook: add it once to the
+// root logger and all its clones share the same sequence.
+func NewHookSeq() genelog.Hook {
+	return NewHookSeqCounter(new(uint64))
+}
+
+// NewHookSeqCounter returns a hook like NewHookSeq incrementing
+// counter, shared by the hooks given it, like those of successive
+// configurations of a logger. The sequence starts after its value.
+func NewHookSeqCounter(counter *uint64) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := v.(Sequencer)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Sequencer interface", v)
+		}
+		context.SeqSet(atomic.AddUint64(counter, 1))
+		return context, msg, nil
+	}
+}
+
+// NewHookID returns a hook setting the entry ID generated by gen,
+// typically NewULID or NewUUIDv7.
+func NewHookID(gen func() (string, error)) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := v.(Identifier)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Identifier interface", v)
+		}
+		id, err := gen()
+		if err != nil {
+			return nil, "", err
+		}
+		context.IDSet(id)
+		return context, msg, nil
+	}
+}
+
+// HookULID sets a new ULID as entry ID
+func HookULID(v interface{}, msg string) (interface{}, string, error) {
+	return NewHookID(NewULID)(v, msg)
+}
+
+// crockford is the base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID made of the current time in milliseconds
+// and 80 random bits, encoded in 26 Crockford base32 characters.
+func NewULID() (string, error) {
+	return newULID(time.Now(), rand.Reader)
+}
+
+func newULID(t time.Time, r io.Reader) (string, error) {
+	var id [16]byte
+
+	putMillis(id[:6], t)
+	if _, err := io.ReadFull(r, id[6:]); err != nil {
+		return "", fmt.Errorf("ulid: %w", err)
+	}
+
+	// 128 bits are encoded in 26 characters of 5 bits,
+	// the 2 leading padding bits being zero
+	out := make([]byte, 26)
+	for i := range out {
+		// bit offset of the character in the 130 bits stream
+		offset := i*5 - 2
+
+		var c byte
+		for b := 0; b < 5; b++ {
+			bit := offset + b
+			c <<= 1
+			if bit >= 0 && id[bit/8]&(0x80>>(bit%8)) != 0 {
+				c |= 1
+			}
+		}
+		out[i] = crockford[c]
+	}
+
+	return string(out), nil
+}
+
+// NewUUIDv7 returns a RFC 9562 version 7 UUID made of the current
+// time in milliseconds and 74 random bits.
+func NewUUIDv7() (string, error) {
+	return newUUIDv7(time.Now(), rand.Reader)
+}
+
+func newUUIDv7(t time.Time, r io.Reader) (string, error) {
+	var id [16]byte
+
+	putMillis(id[:6], t)
+	if _, err := io.ReadFull(r, id[6:]); err != nil {
+		return "", fmt.Errorf("uuid: %w", err)
+	}
+
+	// version 7 and variant 10
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+
+	return string(buf), nil
+}
+
+// putMillis writes the unix time of t in milliseconds
+// as a 48 bits big endian integer
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
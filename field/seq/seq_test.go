@@ -0,0 +1,194 @@
+package seq
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/format/json"
+)
+
+type exampleWithSeq struct {
+	*WithSeq
+}
+
+func ExampleNewHookSeq() {
+	buf := bytes.Buffer{}
+
+	context := exampleWithSeq{
+		NewWithSeq(),
+	}
+
+	logger := genelog.New(&buf).
+		WithContext(context).
+		WithFormatter(json.JSON).
+		AddHook(NewHookSeq())
+
+	logger.Println("mylog1")
+	logger.Println("mylog2")
+
+	fmt.Print(&buf)
+
+	// Output:
+	// {"context":{"seq":1},"message":"mylog1"}
+	// {"context":{"seq":2},"message":"mylog2"}
+}
+
+func TestNewHookSeq_clones(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	logger := genelog.New(&buf).
+		WithContext(exampleWithSeq{NewWithSeq()}).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			context, ok := v.(Sequencer)
+			if !ok {
+				return "", fmt.Errorf("%T: not Sequencer type", v)
+			}
+			return fmt.Sprintf("%d %s", context.Seq(), msg), nil
+		}).
+		AddHook(NewHookSeq())
+
+	logger1 := logger.WithContext(exampleWithSeq{NewWithSeq()})
+	logger2 := logger.WithContext(exampleWithSeq{NewWithSeq()})
+
+	logger.Println("root")
+	logger1.Println("logger1")
+	logger2.Println("logger2")
+	logger1.Println("logger1")
+
+	want := `1 root
+2 logger1
+3 logger2
+4 logger1
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+// copierWithSeq is copied for each entry
+type copierWithSeq struct {
+	*WithSeq
+}
+
+func (c copierWithSeq) Copy() interface{} {
+	withSeq := *c.WithSeq
+	return copierWithSeq{&withSeq}
+}
+
+func TestNewHookSeq_concurrent(t *testing.T) {
+	const goroutines, lines = 8, 200
+
+	format := func(v interface{}, msg string) (string, error) {
+		return fmt.Sprint(v.(Sequencer).Seq()), nil
+	}
+
+	testSuite := map[string]*genelog.Logger{
+		"serialized": genelog.New(nil).
+			WithContext(exampleWithSeq{NewWithSeq()}).
+			WithFormatter(format).
+			AddHook(NewHookSeq()),
+		"ordered copies": genelog.New(nil).
+			WithContext(copierWithSeq{NewWithSeq()}).
+			WithFormatter(format).
+			AddOrderedHook(NewHookSeq()),
+	}
+
+	for name, logger := range testSuite {
+		buf := bytes.Buffer{}
+		logger.SetOutput(&buf)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < lines; j++ {
+					logger.Println("mylog")
+				}
+			}()
+		}
+		wg.Wait()
+
+		for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			if want := fmt.Sprint(i + 1); line != want {
+				t.Fatalf("%s: line %d: want: %s, got: %s", name, i+1, want, line)
+			}
+		}
+	}
+}
+
+func TestNewHookSeq_notSequencer(t *testing.T) {
+	if _, _, err := NewHookSeq()("context", "msg"); err == nil {
+		t.Fatal("expecting error")
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	// first 10 characters encode the time
+	// from the ULID specification example
+	now := time.Unix(0, 1469918176385*int64(time.Millisecond))
+	random := bytes.NewReader(make([]byte, 10))
+
+	got, err := newULID(now, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "01ARYZ6S410000000000000000"; got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	id1, err := NewULID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := NewULID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 == id2 {
+		t.Fatalf("%s: ULIDs should be unique", id1)
+	}
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	now := time.Unix(0, 1645557742000*int64(time.Millisecond))
+	random := bytes.NewReader(bytes.Repeat([]byte{0xff}, 10))
+
+	got, err := newUUIDv7(now, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "017f22e2-79b0-7fff-bfff-ffffffffffff"; got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	id, err := NewUUIDv7()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re.MatchString(id) {
+		t.Fatalf("%s: not a UUIDv7", id)
+	}
+}
+
+func TestHookULID(t *testing.T) {
+	context := exampleWithSeq{NewWithSeq()}
+
+	if _, _, err := HookULID(context, "msg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := context.ID(); len(id) != 26 || strings.Trim(id, crockford) != "" {
+		t.Fatalf("%s: not a ULID", id)
+	}
+}
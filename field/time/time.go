@@ -24,6 +24,13 @@ func NewWithTime(t time.Time) *WithTime {
 	}
 }
 
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithTime) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
 func (w WithTime) Time() time.Time {
 	return w.time
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -153,3 +154,30 @@ func TestWithType_UnmarshalJSON(t *testing.T) {
 		t.Fatalf("reading standard input: %v", err)
 	}
 }
+
+func TestHookUpdateTime_concurrent(t *testing.T) {
+	const goroutines, lines = 8, 100
+
+	buf := bytes.Buffer{}
+	logger := genelog.New(&buf).
+		WithContext(exampleWithTime{NewWithTime(time.Time{})}).
+		WithFormatter(json.JSON).
+		AddHook(HookUpdateTime)
+
+	// the entries sharing the *WithTime are serialized
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				logger.Println("mylog")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := strings.Count(buf.String(), "\n"); got != goroutines*lines {
+		t.Fatalf("want %d lines, got: %d", goroutines*lines, got)
+	}
+}
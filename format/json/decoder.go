@@ -0,0 +1,130 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Entry is a log line decoded from the JSON format
+type Entry struct {
+	// Context is the decoded context
+	Context interface{}
+	Message string
+	// Line is the line number of the entry, starting at 1
+	Line int
+}
+
+// LineError reports a line that can't be decoded
+type LineError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+var ErrNoMessage = errors.New("json decoder: no message")
+
+// Decoder reads entries written by JSON, one per line
+type Decoder struct {
+	r       *bufio.Reader
+	context func() interface{}
+	line    int
+}
+
+// NewDecoder returns a decoder reading r.
+//
+// newContext returns the pointer each context is decoded into, like
+// a pointer to the context type of the logger with UnmarshalJSON
+// methods. If nil, contexts are decoded into interface{} values,
+// with the numbers as json.Number.
+func NewDecoder(r io.Reader, newContext func() interface{}) *Decoder {
+	return &Decoder{
+		r:       bufio.NewReader(r),
+		context: newContext,
+	}
+}
+
+// Decode returns the next entry, or io.EOF at the end of the input.
+//
+// Empty lines are skipped. A line that can't be decoded is reported
+// with a *LineError, and the next call decodes the following line.
+func (d *Decoder) Decode() (Entry, error) {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return Entry{}, err
+		}
+		d.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var context interface{}
+		if d.context != nil {
+			context = d.context()
+		}
+
+		entry, decodeErr := DecodeLine(line, context)
+		var invalid *json.InvalidUnmarshalError
+		if errors.As(decodeErr, &invalid) {
+			return Entry{}, decodeErr
+		}
+		if decodeErr != nil {
+			return Entry{}, &LineError{Line: d.line, Text: string(line), Err: decodeErr}
+		}
+
+		entry.Line = d.line
+		return entry, nil
+	}
+}
+
+// DecodeLine decodes a line written by JSON.
+//
+// The context is decoded into context, which must be a pointer, or
+// into an interface{} value if context is nil.
+func DecodeLine(line []byte, context interface{}) (Entry, error) {
+	var m struct {
+		Context json.RawMessage `json:"context"`
+		Message *string         `json:"message"`
+	}
+	if err := json.Unmarshal(line, &m); err != nil {
+		return Entry{}, err
+	}
+	if m.Message == nil {
+		return Entry{}, ErrNoMessage
+	}
+
+	entry := Entry{Message: *m.Message}
+
+	if context == nil {
+		if len(m.Context) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(m.Context))
+			dec.UseNumber()
+			if err := dec.Decode(&entry.Context); err != nil {
+				return Entry{}, err
+			}
+		}
+		return entry, nil
+	}
+
+	if len(m.Context) > 0 {
+		if err := json.Unmarshal(m.Context, context); err != nil {
+			return Entry{}, err
+		}
+	}
+	entry.Context = context
+	return entry, nil
+}
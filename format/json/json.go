@@ -1,6 +1,8 @@
 // Package JSON formats log outputs into JSON using
 // the structure { "context": {}, "message": "message" }
 //
+// Decoder reads the entries back, for tooling, replays and tests.
+//
 // Note that the encoding/json package used underneath
 // does not work with embbeded structures until the go
 // issue https://github.com/golang/go/issues/6213
@@ -48,3 +50,39 @@ func JSON(v interface{}, msg string) (string, error) {
 	// Trim the last newline character added by json.Encoder
 	return strings.TrimSuffix(buf.String(), "\n"), nil
 }
+
+// Fields returns the top level fields of the JSON encoded context
+// v, to be exported by sinks with flat key/value records.
+//
+// String values are decoded, other values are kept JSON encoded.
+// If v is not encoded into an object, it is returned under the
+// "context" key.
+func Fields(v interface{}) (map[string]string, error) {
+	fields := make(map[string]string)
+	if v == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		// not an object
+		fields["context"] = string(b)
+		return fields, nil
+	}
+
+	for k, raw := range m {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			fields[k] = s
+			continue
+		}
+		fields[k] = string(raw)
+	}
+
+	return fields, nil
+}
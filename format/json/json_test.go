@@ -2,11 +2,16 @@ package json
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
 )
 
 func ExampleJSON() {
@@ -53,3 +58,133 @@ func TestJSON(t *testing.T) {
 		t.Fatalf("\nwant:\n%s\ngot:\n%s\n", want, got)
 	}
 }
+
+func TestFields(t *testing.T) {
+	c := struct {
+		A string `json:"a"`
+		N int    `json:"n"`
+		C C      `json:"c"`
+	}{"a", 1, C{"x", "y"}}
+
+	got, err := Fields(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"a": "a",
+		"n": "1",
+		"c": `{"A":"x","B":"y"}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: want: %s, got: %s", k, v, got[k])
+		}
+	}
+
+	if got, err := Fields(3); err != nil || got["context"] != "3" {
+		t.Fatalf("want context field, got: %v, %v", got, err)
+	}
+}
+
+func ExampleDecoder() {
+	type Context struct {
+		Level level.Level `json:"level"`
+		Time  time.Time   `json:"time"`
+	}
+
+	logs := `{"context":{"level":"info","time":"2022-02-01T12:30:00Z"},"message":"started"}
+{"context":{"level":"error","time":"2022-02-01T12:31:00Z"},"message":"failed"}
+`
+
+	dec := NewDecoder(strings.NewReader(logs), func() interface{} {
+		return &Context{}
+	})
+
+	for {
+		entry, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		context := entry.Context.(*Context)
+		fmt.Println(entry.Line, context.Time.Format(time.Kitchen), context.Level, entry.Message)
+	}
+
+	// Output:
+	// 1 12:30PM info started
+	// 2 12:31PM error failed
+}
+
+func TestDecoder(t *testing.T) {
+	logs := `{"context":{"level":"info"},"message":"first"}
+
+not json
+{"context":{"level":"loud"},"message":"unknown level"}
+{"context":{"level":"debug"}}
+{"context":{"level":"warning"},"message":"last"}`
+
+	dec := NewDecoder(strings.NewReader(logs), func() interface{} {
+		return level.NewWithLevel(level.DEBUG)
+	})
+
+	type result struct {
+		line    int
+		level   level.Level
+		message string
+	}
+	results := make([]result, 0)
+	errLines := make([]int, 0)
+
+	for {
+		entry, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			errLines = append(errLines, lineErr.Line)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := entry.Context.(*level.WithLevel).Level()
+		results = append(results, result{entry.Line, l, entry.Message})
+	}
+
+	want := []result{{1, level.INFO, "first"}, {6, level.WARNING, "last"}}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Fatalf("want: %v, got: %v", want, results)
+	}
+	if fmt.Sprint(errLines) != "[3 4 5]" {
+		t.Fatalf("want error lines [3 4 5], got: %v", errLines)
+	}
+}
+
+func TestDecodeLine(t *testing.T) {
+	entry, err := DecodeLine([]byte(`{"context":{"n":12345678901234567890,"s":"a"},"message":"m"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := entry.Context.(map[string]interface{})
+	if context["n"] != json.Number("12345678901234567890") || context["s"] != "a" {
+		t.Fatalf("%v: wrong context", context)
+	}
+
+	// a context that is not a pointer can't be decoded
+	_, err = NewDecoder(strings.NewReader(`{"context":{},"message":"m"}`), func() interface{} {
+		return struct{}{}
+	}).Decode()
+	var invalid *json.InvalidUnmarshalError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("want InvalidUnmarshalError, got: %v", err)
+	}
+}
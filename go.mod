@@ -4,11 +4,10 @@ go 1.17
 
 require (
 	github.com/fatih/color v1.13.0
+	github.com/mattn/go-isatty v0.0.14
 	github.com/rs/zerolog v1.26.1
+	golang.org/x/sys v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/mattn/go-colorable v0.1.9 // indirect
-	github.com/mattn/go-isatty v0.0.14 // indirect
-	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e // indirect
-)
+require github.com/mattn/go-colorable v0.1.9 // indirect
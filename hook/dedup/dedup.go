@@ -0,0 +1,284 @@
+// Package dedup collapses consecutive identical log entries.
+//
+// The first entry of a series is written, the following identical
+// ones are skipped with genelog.ErrSkip. The series ended by a
+// different entry are reported once with their repeat count and
+// first/last timestamps on Flush, and at every interval set with
+// WithInterval.
+package dedup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// Repeat describes a series of identical entries
+type Repeat struct {
+	// Count is the number of entries in the series, the first included
+	Count uint64
+	// First is the time of the first entry
+	First time.Time
+	// Last is the time of the last entry
+	Last time.Time
+	// Level is the level of the entries, if their context
+	// implements level.Leveler
+	Level level.Level
+}
+
+type WithRepeat struct {
+	repeat Repeat
+}
+
+// withRepeatJSON is an helper structure
+// to decode json from WithRepeat with
+// private attributes
+type withRepeatJSON struct {
+	Repeat uint64    `json:"repeat"`
+	First  time.Time `json:"first"`
+	Last   time.Time `json:"last"`
+}
+
+func NewWithRepeat() *WithRepeat {
+	return &WithRepeat{}
+}
+
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithRepeat) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
+func (w WithRepeat) Repeat() Repeat {
+	return w.repeat
+}
+
+func (w *WithRepeat) RepeatSet(r Repeat) {
+	w.repeat = r
+}
+
+func (w WithRepeat) MarshalJSON() ([]byte, error) {
+	return json.Marshal(withRepeatJSON{
+		Repeat: w.repeat.Count,
+		First:  w.repeat.First,
+		Last:   w.repeat.Last,
+	})
+}
+
+func (w *WithRepeat) UnmarshalJSON(b []byte) error {
+	if w == nil {
+		return errors.New("logger: json decoder: WithRepeat is nil")
+	}
+
+	var withRepeat withRepeatJSON
+	if err := json.Unmarshal(b, &withRepeat); err != nil {
+		return err
+	}
+
+	w.repeat = Repeat{
+		Count: withRepeat.Repeat,
+		First: withRepeat.First,
+		Last:  withRepeat.Last,
+	}
+
+	return nil
+}
+
+// Repeater is the interface to access the repeat field
+type Repeater interface {
+	Repeat() Repeat
+	RepeatSet(Repeat)
+}
+
+// series is a run of identical entries
+type series struct {
+	// context is a copy of the context of the first entry
+	// if it can be copied, or else the context itself
+	context interface{}
+	msg     string
+	repeat  Repeat
+}
+
+// Dedup skips consecutive identical entries.
+//
+// Entries are identical when they have the same message and,
+// if the context implements level.Leveler, the same level.
+type Dedup struct {
+	mu      sync.Mutex
+	current *series
+	// ended are the series ended by a different entry, not reported yet
+	ended   []series
+	summary func(context interface{}, msg string, repeat Repeat)
+	now     func() time.Time
+	// ticking starts the ticker reporting the ended series
+	ticking sync.Once
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func New() *Dedup {
+	return &Dedup{
+		now:  time.Now,
+		done: make(chan struct{}),
+	}
+}
+
+// WithSummary sets the function reporting a series of more than
+// one entry. Summary logs it to a logger.
+//
+// fn is called by Flush and the ticker of WithInterval, never from
+// the hook: it can log to any logger, including the one running
+// this deduplicator.
+func (d *Dedup) WithSummary(fn func(context interface{}, msg string, repeat Repeat)) *Dedup {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.summary = fn
+	return d
+}
+
+// WithInterval starts a ticker reporting the ended series
+// at every interval, until Close is called
+func (d *Dedup) WithInterval(interval time.Duration) *Dedup {
+	if interval > 0 {
+		d.ticking.Do(func() { d.run(interval) })
+	}
+	return d
+}
+
+// run reports the ended series at every interval
+func (d *Dedup) run(interval time.Duration) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.report(false)
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// Hook skips the entries identical to the previous one
+func (d *Dedup) Hook(v interface{}, msg string) (interface{}, string, error) {
+	var l level.Level
+	if leveler, ok := level.GetLeveler(v); ok {
+		l = leveler.Level()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+
+	if d.current != nil && d.current.msg == msg && d.current.repeat.Level == l {
+		d.current.repeat.Count++
+		d.current.repeat.Last = now
+		return v, msg, genelog.ErrSkip
+	}
+
+	d.end()
+
+	// the context of the entry may be shared with the next ones
+	context, _ := genelog.CopyContext(v)
+	d.current = &series{
+		context: context,
+		msg:     msg,
+		repeat: Repeat{
+			Count: 1,
+			First: now,
+			Last:  now,
+			Level: l,
+		},
+	}
+
+	return v, msg, nil
+}
+
+// end ends the current series, kept to be reported
+// if it has more than one entry
+func (d *Dedup) end() {
+	if d.current != nil && d.current.repeat.Count > 1 && d.summary != nil {
+		d.ended = append(d.ended, *d.current)
+	}
+	d.current = nil
+}
+
+// Flush ends the current series and reports the ended ones
+func (d *Dedup) Flush() {
+	d.report(true)
+}
+
+// Close stops the ticker and reports the series like Flush
+func (d *Dedup) Close() error {
+	d.mu.Lock()
+	select {
+	case <-d.done:
+	default:
+		close(d.done)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	d.Flush()
+	return nil
+}
+
+// report reports the ended series, ending the current one first
+// if flush is true. The summary is called unlocked, free to log.
+func (d *Dedup) report(flush bool) {
+	d.mu.Lock()
+	if flush {
+		d.end()
+	}
+	ended, summary := d.ended, d.summary
+	d.ended = nil
+	d.mu.Unlock()
+
+	if summary == nil {
+		return
+	}
+	for _, s := range ended {
+		summary(s.context, s.msg, s.repeat)
+	}
+}
+
+// Summary returns a summary function writing the series to logger,
+// at the level of the series if the context implements level.Leveler.
+//
+// If the context of the series implements Repeater and is copied by
+// genelog.CopyContext, the repeat field is set on the copy. Otherwise,
+// the message is suffixed with the repeat count and the time range.
+func Summary(logger *genelog.Logger) func(context interface{}, msg string, repeat Repeat) {
+	return func(v interface{}, msg string, repeat Repeat) {
+		setLevel := func(v interface{}, msg string) (interface{}, string, error) {
+			if leveler, ok := level.GetLeveler(v); ok {
+				leveler.LevelSet(repeat.Level)
+			}
+			return v, msg, nil
+		}
+
+		context, copied := genelog.CopyContext(v)
+		if repeater, ok := context.(Repeater); ok && copied {
+			repeater.RepeatSet(repeat)
+			logger.WithContext(context).PrintlnWith(setLevel, msg)
+			return
+		}
+
+		logger.WithContext(v).PrintlnWith(setLevel, fmt.Sprintf("%s (repeated %d times from %s to %s)",
+			msg,
+			repeat.Count,
+			repeat.First.Format(time.RFC3339),
+			repeat.Last.Format(time.RFC3339)))
+	}
+}
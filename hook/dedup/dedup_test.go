@@ -0,0 +1,169 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/format/json"
+)
+
+func ExampleDedup() {
+	buf := bytes.Buffer{}
+
+	dedup := New().
+		WithSummary(Summary(genelog.New(&buf)))
+	dedup.now = func() time.Time {
+		return time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	}
+
+	logger := genelog.New(&buf).
+		AddHook(dedup.Hook)
+
+	logger.Println("connection refused")
+	logger.Println("connection refused")
+	logger.Println("connection refused")
+	logger.Println("connected")
+	dedup.Flush()
+
+	fmt.Print(&buf)
+
+	// Output:
+	// connection refused
+	// connected
+	// connection refused (repeated 3 times from 2022-02-01T12:30:00Z to 2022-02-01T12:30:00Z)
+}
+
+type exampleWithRepeat struct {
+	*WithRepeat
+}
+
+func TestDedup_Repeater(t *testing.T) {
+	buf := bytes.Buffer{}
+	summary := bytes.Buffer{}
+
+	now := time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	dedup := New().
+		WithSummary(Summary(genelog.New(&summary).WithFormatter(json.JSON)))
+	dedup.now = func() time.Time { return now }
+
+	logger := genelog.New(&buf).
+		WithContext(exampleWithRepeat{NewWithRepeat()}).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return fmt.Sprintf("%s %d", msg, v.(Repeater).Repeat().Count), nil
+		}).
+		AddHook(dedup.Hook)
+
+	logger.Println("a")
+	now = now.Add(time.Second)
+	logger.Println("a")
+	logger.Println("b")
+
+	// a single entry is not reported
+	logger.Println("c")
+	dedup.Flush()
+
+	// the summary does not change the repeat field of the next entries
+	if want, got := "a 0\nb 0\nc 0\n", buf.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	want := `{"context":{"repeat":2,"first":"2022-02-01T12:30:00Z","last":"2022-02-01T12:30:01Z"},"message":"a"}` + "\n"
+	if got := summary.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+// copierWithRepeat is copied for each entry
+type copierWithRepeat struct {
+	*WithRepeat
+}
+
+func (c copierWithRepeat) Copy() interface{} {
+	withRepeat := *c.WithRepeat
+	return copierWithRepeat{&withRepeat}
+}
+
+func TestSummary_copier(t *testing.T) {
+	summary := bytes.Buffer{}
+	context := copierWithRepeat{NewWithRepeat()}
+
+	Summary(genelog.New(&summary).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return fmt.Sprintf("%s %d", msg, v.(Repeater).Repeat().Count), nil
+		}))(context, "a", Repeat{Count: 2})
+
+	if want, got := "a 2\n", summary.String(); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	if count := context.Repeat().Count; count != 0 {
+		t.Fatalf("context updated: %d", count)
+	}
+}
+
+type levelWithRepeat struct {
+	*level.WithLevel
+	*WithRepeat
+}
+
+func TestSummary_level(t *testing.T) {
+	buf := bytes.Buffer{}
+	dedup := New()
+
+	logger := genelog.New(&buf).
+		WithContext(levelWithRepeat{level.NewWithLevel(level.INFO), NewWithRepeat()}).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			context := v.(levelWithRepeat)
+			return fmt.Sprintf("%s %s %d", context.Level(), msg, context.Repeat().Count), nil
+		}).
+		AddHook(dedup.Hook).
+		AddHook(level.NewHookLevelMin(level.WARNING))
+
+	// the summary is logged by the deduplicated logger
+	dedup.WithSummary(Summary(logger))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		level.Errorln(logger, "boom")
+		level.Errorln(logger, "boom")
+		level.Errorln(logger, "boom")
+		level.Infoln(logger, "ok")
+		dedup.Flush()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+
+	// the summary is logged at the level of the series
+	if want, got := "error boom 0\nerror boom 3\n", buf.String(); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestDedup_concurrent(t *testing.T) {
+	dedup := New()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _, _ = dedup.Hook(nil, "msg")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want, got := uint64(1000), dedup.current.repeat.Count; want != got {
+		t.Fatalf("count: want: %d, got: %d", want, got)
+	}
+}
@@ -0,0 +1,68 @@
+// Package hook combines hooks, to apply them to part of the entries
+// or to register a series of hooks under a single name.
+//
+//	logger := level.NewLevelLogger(os.Stdout).
+//		AddNamedHook("caller", hook.ForLevels(
+//			[]level.Level{level.WARNING, level.ERROR},
+//			caller.HookCaller,
+//		)).
+//		AddNamedHook("redact", redactor.Hook)
+package hook
+
+import (
+	"fmt"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// Predicate selects entries by their context and message
+type Predicate func(context interface{}, msg string) bool
+
+// When returns a hook calling h on the entries selected by predicate,
+// and passing the other ones unchanged
+func When(predicate Predicate, h genelog.Hook) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		if !predicate(v, msg) {
+			return v, msg, nil
+		}
+		return h(v, msg)
+	}
+}
+
+// ForLevels returns a hook calling h on the entries at one of levels,
+// and passing the other ones unchanged.
+//
+// The context must implement the level.Leveler interface.
+func ForLevels(levels []level.Level, h genelog.Hook) genelog.Hook {
+	set := make(map[level.Level]bool, len(levels))
+	for _, l := range levels {
+		set[l] = true
+	}
+
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := v.(level.Leveler)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Leveler interface", v)
+		}
+		if !set[context.Level()] {
+			return v, msg, nil
+		}
+		return h(v, msg)
+	}
+}
+
+// Chain returns a hook calling hooks in order, stopping at the first
+// error, like the hooks of a logger
+func Chain(hooks ...genelog.Hook) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		var err error
+		for _, h := range hooks {
+			v, msg, err = h(v, msg)
+			if err != nil {
+				return v, msg, err
+			}
+		}
+		return v, msg, nil
+	}
+}
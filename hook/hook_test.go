@@ -0,0 +1,83 @@
+package hook
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+type exampleWithLevel struct {
+	*level.WithLevel
+}
+
+func ExampleForLevels() {
+	upper := func(v interface{}, msg string) (interface{}, string, error) {
+		return v, strings.ToUpper(msg), nil
+	}
+
+	logger := level.LevelLogger{Logger: genelog.New(os.Stdout)}.
+		AddHook(ForLevels([]level.Level{level.ERROR, level.FATAL}, upper)).
+		WithContext(exampleWithLevel{level.NewWithLevel(level.INFO)})
+
+	logger.Infoln("started")
+	logger.Errorln("failed")
+
+	// Output:
+	// started
+	// FAILED
+}
+
+func suffix(s string) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		return v, msg + s, nil
+	}
+}
+
+func TestHooks(t *testing.T) {
+	errHook := errors.New("hook failed")
+	fail := func(v interface{}, msg string) (interface{}, string, error) {
+		return v, msg, errHook
+	}
+	short := func(v interface{}, msg string) bool {
+		return len(msg) < 4
+	}
+	context := exampleWithLevel{level.NewWithLevel(level.DEBUG)}
+	context.LevelSet(level.WARNING)
+
+	testSuite := map[string]struct {
+		hook    genelog.Hook
+		context interface{}
+		msg     string
+		want    string
+		err     error
+	}{
+		"when selected":       {When(short, suffix("!")), nil, "abc", "abc!", nil},
+		"when not selected":   {When(short, suffix("!")), nil, "abcd", "abcd", nil},
+		"levels selected":     {ForLevels([]level.Level{level.WARNING}, suffix("!")), context, "a", "a!", nil},
+		"levels not selected": {ForLevels([]level.Level{level.ERROR}, suffix("!")), context, "a", "a", nil},
+		"chain":               {Chain(suffix("1"), suffix("2")), nil, "a", "a12", nil},
+		"chain error":         {Chain(suffix("1"), fail, suffix("2")), nil, "a", "a1", errHook},
+		"chain empty":         {Chain(), nil, "a", "a", nil},
+	}
+
+	for name, test := range testSuite {
+		_, msg, err := test.hook(test.context, test.msg)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want error: %v, got: %v", name, test.err, err)
+		}
+		if msg != test.want {
+			t.Fatalf("%s: want: %q, got: %q", name, test.want, msg)
+		}
+	}
+}
+
+func TestForLevels_noLeveler(t *testing.T) {
+	h := ForLevels([]level.Level{level.INFO}, suffix("!"))
+	if _, _, err := h(struct{}{}, "a"); err == nil {
+		t.Fatal("want an error")
+	}
+}
@@ -0,0 +1,127 @@
+// Package ratelimit provides a token bucket hook capping
+// the number of log entries per second.
+//
+// Entries over the limit are skipped with genelog.ErrSkip.
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// maxIdleBuckets is the number of buckets above which
+// full buckets are removed
+const maxIdleBuckets = 1024
+
+// KeyFunc returns the bucket key of an entry
+type KeyFunc func(context interface{}, msg string) string
+
+// KeyMessage uses the level, if the context implements
+// level.Leveler, and the message as key
+func KeyMessage(v interface{}, msg string) string {
+	if leveler, ok := level.GetLeveler(v); ok {
+		return leveler.Level().String() + ":" + msg
+	}
+	return msg
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter limits the rate of log entries with token buckets.
+//
+// The limiter owns its buckets: add it once to the root logger
+// and all its clones share the same limits.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	key     KeyFunc
+	buckets map[string]*bucket
+	dropped uint64
+	now     func() time.Time
+}
+
+// New returns a limiter allowing rate entries per second
+// with bursts of burst entries for the whole logger.
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// NewPerKey returns a limiter allowing rate entries per second
+// with bursts of burst entries for each key returned by key.
+func NewPerKey(rate float64, burst int, key KeyFunc) *Limiter {
+	limiter := New(rate, burst)
+	limiter.key = key
+	return limiter
+}
+
+// Hook skips the entries over the limit
+func (l *Limiter) Hook(v interface{}, msg string) (interface{}, string, error) {
+	var k string
+	if l.key != nil {
+		k = l.key(v, msg)
+	}
+
+	if !l.allow(k) {
+		atomic.AddUint64(&l.dropped, 1)
+		return v, msg, genelog.ErrSkip
+	}
+	return v, msg, nil
+}
+
+// Dropped returns the number of skipped entries
+func (l *Limiter) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// allow takes a token from the bucket k if any
+func (l *Limiter) allow(k string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	b, ok := l.buckets[k]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.purge(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[k] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// purge removes the buckets refilled since their last use,
+// they are the same as new ones
+func (l *Limiter) purge(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
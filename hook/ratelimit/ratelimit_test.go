@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+)
+
+func ExampleLimiter() {
+	buf := bytes.Buffer{}
+
+	limiter := New(1, 2)
+
+	logger := genelog.New(&buf).
+		AddHook(limiter.Hook)
+
+	for i := 0; i < 5; i++ {
+		logger.Println("crash loop")
+	}
+
+	fmt.Print(&buf)
+	fmt.Println(limiter.Dropped(), "dropped")
+
+	// Output:
+	// crash loop
+	// crash loop
+	// 3 dropped
+}
+
+func TestLimiter_refill(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	limiter := NewPerKey(2, 1, KeyMessage)
+	limiter.now = func() time.Time { return now }
+
+	buf := bytes.Buffer{}
+	logger := genelog.New(&buf).
+		AddHook(limiter.Hook)
+
+	logger.Println("a")
+	logger.Println("a")
+	logger.Println("b")
+
+	now = now.Add(500 * time.Millisecond)
+	logger.Println("a")
+	logger.Println("a")
+
+	if want, got := "a\nb\na\n", buf.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+	if want, got := uint64(2), limiter.Dropped(); want != got {
+		t.Fatalf("dropped: want: %d, got: %d", want, got)
+	}
+}
+
+func TestLimiter_purge(t *testing.T) {
+	now := time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	limiter := NewPerKey(1, 1, KeyMessage)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < maxIdleBuckets; i++ {
+		_, _, _ = limiter.Hook(nil, fmt.Sprint(i))
+	}
+
+	now = now.Add(time.Second)
+	_, _, _ = limiter.Hook(nil, "new")
+
+	if n := len(limiter.buckets); n != 1 {
+		t.Fatalf("want 1 bucket after purge, got: %d", n)
+	}
+}
+
+func TestLimiter_concurrent(t *testing.T) {
+	limiter := New(0, 100)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, _, _ = limiter.Hook(nil, "msg")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want, got := uint64(100), limiter.Dropped(); want != got {
+		t.Fatalf("dropped: want: %d, got: %d", want, got)
+	}
+}
@@ -0,0 +1,439 @@
+// Package redact scrubs secrets and personal data from log entries.
+//
+// A Redactor rewrites both the message and a copy of the context
+// before formatting:
+//   - strings matching a rule (regexp or known credential pattern)
+//     are masked in the message and in the context
+//   - struct fields tagged `log:"redact"` are masked
+//   - struct fields and map entries whose name is in the deny list
+//     are masked
+//
+// The context given to the logger is never modified: only the parts
+// that need masking are copied, other values (pointers in particular)
+// are passed through untouched.
+//
+// Unexported struct fields can't be rewritten and are left as is.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// TagName is the struct tag key read by the Redactor.
+// Fields tagged `log:"redact"` are always masked.
+const TagName = "log"
+
+// maxDepth stops the context walk on deep or cyclic structures
+const maxDepth = 32
+
+// Mask replaces a sensitive string
+type Mask func(s string) string
+
+// MaskFixed replaces sensitive strings with s
+func MaskFixed(s string) Mask {
+	return func(string) string {
+		return s
+	}
+}
+
+// MaskHash replaces sensitive strings with a keyed hash so that
+// the same secret always gives the same mask, allowing correlation
+// across entries without revealing the value.
+func MaskHash(key []byte) Mask {
+	return func(s string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(s))
+		return "[REDACTED:" + hex.EncodeToString(mac.Sum(nil))[:16] + "]"
+	}
+}
+
+// Rule matches sensitive data in strings.
+//
+// If Pattern has a capturing group, only the first group is masked,
+// allowing to keep a prefix such as "Bearer ".
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Valid filters out false positives when not nil
+	Valid func(match string) bool
+}
+
+// Known credential and personal data patterns
+var (
+	RuleBearer = Rule{
+		Name:    "bearer",
+		Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	}
+	RuleAWSAccessKey = Rule{
+		Name:    "aws-access-key",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	}
+	RuleJWT = Rule{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+`),
+	}
+	RuleCreditCard = Rule{
+		Name:    "credit-card",
+		Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Valid:   luhn,
+	}
+	RuleEmail = Rule{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+)
+
+// DefaultRules lists all the known patterns
+var DefaultRules = []Rule{
+	RuleBearer,
+	RuleAWSAccessKey,
+	RuleJWT,
+	RuleCreditCard,
+	RuleEmail,
+}
+
+// DefaultKeys lists common names of sensitive fields
+var DefaultKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"authorization",
+	"api_key",
+	"apikey",
+}
+
+// Redactor masks sensitive data from messages and contexts
+type Redactor struct {
+	rules []Rule
+	// keys is the lowercased deny list of field and map key names
+	keys map[string]struct{}
+	mask Mask
+}
+
+// New returns a Redactor with no rules, no deny list
+// and masking with "[REDACTED]".
+//
+// Only the fields tagged `log:"redact"` are masked until rules
+// or keys are added.
+func New() *Redactor {
+	return &Redactor{
+		rules: make([]Rule, 0),
+		keys:  make(map[string]struct{}),
+		mask:  MaskFixed("[REDACTED]"),
+	}
+}
+
+func (r *Redactor) clone() *Redactor {
+	redactor := New()
+	redactor.rules = append(redactor.rules, r.rules...)
+	for k := range r.keys {
+		redactor.keys[k] = struct{}{}
+	}
+	redactor.mask = r.mask
+	return redactor
+}
+
+// WithRules adds rules to the redactor
+func (r *Redactor) WithRules(rules ...Rule) *Redactor {
+	redactor := r.clone()
+	redactor.rules = append(redactor.rules, rules...)
+	return redactor
+}
+
+// WithPatterns adds rules from regular expressions
+func (r *Redactor) WithPatterns(patterns ...*regexp.Regexp) *Redactor {
+	rules := make([]Rule, 0, len(patterns))
+	for _, p := range patterns {
+		rules = append(rules, Rule{Name: p.String(), Pattern: p})
+	}
+	return r.WithRules(rules...)
+}
+
+// WithKeys adds names to the deny list.
+//
+// Names are compared case insensitively to struct field names,
+// their json tag name and map keys.
+func (r *Redactor) WithKeys(keys ...string) *Redactor {
+	redactor := r.clone()
+	for _, k := range keys {
+		redactor.keys[strings.ToLower(k)] = struct{}{}
+	}
+	return redactor
+}
+
+// WithMask changes the mask function
+func (r *Redactor) WithMask(mask Mask) *Redactor {
+	redactor := r.clone()
+	redactor.mask = mask
+	return redactor
+}
+
+// Hook masks the message and returns a masked copy of the context
+func (r *Redactor) Hook(v interface{}, msg string) (interface{}, string, error) {
+	msg = r.String(msg)
+
+	if v == nil {
+		return v, msg, nil
+	}
+
+	value, changed := r.value(reflect.ValueOf(v), 0)
+	if !changed {
+		return v, msg, nil
+	}
+	return value.Interface(), msg, nil
+}
+
+// String masks all the rule matches in s
+func (r *Redactor) String(s string) string {
+	for _, rule := range r.rules {
+		s = r.apply(rule, s)
+	}
+	return s
+}
+
+func (r *Redactor) apply(rule Rule, s string) string {
+	matches := rule.Pattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		// mask the first group only if any
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+
+		if rule.Valid != nil && !rule.Valid(s[start:end]) {
+			continue
+		}
+
+		b.WriteString(s[last:start])
+		b.WriteString(r.mask(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+
+	return b.String()
+}
+
+func (r *Redactor) denied(name string) bool {
+	_, ok := r.keys[strings.ToLower(name)]
+	return ok
+}
+
+// masked returns the masked version of v, masking strings
+// and resetting any other type to its zero value.
+// Zero values are left as is by callers: there is nothing to hide.
+func (r *Redactor) masked(v reflect.Value) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		out.SetString(r.mask(v.String()))
+	case reflect.Interface:
+		if !v.IsNil() {
+			out.Set(r.masked(v.Elem()))
+		}
+	}
+	return out
+}
+
+// value returns the redacted version of v and whether it changed.
+// When nothing changed, v is returned as is.
+func (r *Redactor) value(v reflect.Value, depth int) (reflect.Value, bool) {
+	if depth > maxDepth {
+		return v, false
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s := r.String(v.String())
+		if s == v.String() {
+			return v, false
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(s)
+		return out, true
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := r.value(v.Elem(), depth+1)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, true
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := r.value(v.Elem(), depth+1)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(elem)
+		return out, true
+
+	case reflect.Struct:
+		return r.structValue(v, depth)
+
+	case reflect.Map:
+		return r.mapValue(v, depth)
+
+	case reflect.Slice, reflect.Array:
+		return r.listValue(v, depth)
+	}
+
+	return v, false
+}
+
+func (r *Redactor) structValue(v reflect.Value, depth int) (reflect.Value, bool) {
+	var out reflect.Value
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		var value reflect.Value
+		var changed bool
+		if r.fieldDenied(field) {
+			value, changed = r.masked(v.Field(i)), !v.Field(i).IsZero()
+		} else {
+			value, changed = r.value(v.Field(i), depth+1)
+		}
+		if !changed {
+			continue
+		}
+
+		// copy on first change
+		if !out.IsValid() {
+			out = reflect.New(t).Elem()
+			out.Set(v)
+		}
+		out.Field(i).Set(value)
+	}
+
+	if !out.IsValid() {
+		return v, false
+	}
+	return out, true
+}
+
+func (r *Redactor) fieldDenied(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get(TagName), ",") {
+		if opt == "redact" {
+			return true
+		}
+	}
+
+	if r.denied(field.Name) {
+		return true
+	}
+
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	return name != "" && r.denied(name)
+}
+
+func (r *Redactor) mapValue(v reflect.Value, depth int) (reflect.Value, bool) {
+	if v.IsNil() {
+		return v, false
+	}
+
+	changes := make(map[int]reflect.Value)
+	keys := v.MapKeys()
+	for i, key := range keys {
+		var value reflect.Value
+		var changed bool
+		if key.Kind() == reflect.String && r.denied(key.String()) {
+			value, changed = r.masked(v.MapIndex(key)), !v.MapIndex(key).IsZero()
+		} else {
+			value, changed = r.value(v.MapIndex(key), depth+1)
+		}
+		if changed {
+			changes[i] = value
+		}
+	}
+
+	if len(changes) == 0 {
+		return v, false
+	}
+
+	out := reflect.MakeMapWithSize(v.Type(), v.Len())
+	for i, key := range keys {
+		value, ok := changes[i]
+		if !ok {
+			value = v.MapIndex(key)
+		}
+		out.SetMapIndex(key, value)
+	}
+	return out, true
+}
+
+func (r *Redactor) listValue(v reflect.Value, depth int) (reflect.Value, bool) {
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return v, false
+	}
+
+	var out reflect.Value
+	for i := 0; i < v.Len(); i++ {
+		value, changed := r.value(v.Index(i), depth+1)
+		if !changed {
+			continue
+		}
+
+		// copy on first change
+		if !out.IsValid() {
+			if v.Kind() == reflect.Slice {
+				out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(out, v)
+			} else {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+		}
+		out.Index(i).Set(value)
+	}
+
+	if !out.IsValid() {
+		return v, false
+	}
+	return out, true
+}
+
+// luhn checks the credit card number checksum
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,226 @@
+// Package sample provides hooks dropping part of the log entries
+// to cap the volume of hot code paths.
+//
+// Dropped entries are skipped with genelog.ErrSkip.
+package sample
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// key identifies a message
+type key struct {
+	level level.Level
+	msg   string
+}
+
+// Sampler logs the first entries of each message during an interval
+// then only one every thereafter entries, as zap does.
+//
+// Messages are identified by their text and, when the context
+// implements level.Leveler, their level.
+type Sampler struct {
+	mu         sync.Mutex
+	first      uint64
+	thereafter uint64
+	tick       time.Duration
+	// start is the beginning of the current interval
+	start time.Time
+	// counts is the number of entries per message in the interval
+	counts map[key]uint64
+	// dropped is the number of skipped entries per message in the interval
+	dropped map[key]uint64
+	// pending is the number of skipped entries per message in the
+	// ended intervals, not reported yet
+	pending map[key]uint64
+	summary func(msg string, suppressed uint64)
+	now     func() time.Time
+	// ticking starts the ticker reporting the summaries
+	ticking sync.Once
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New returns a sampler logging the first entries of each message
+// per tick, then every thereafter-th entry. A thereafter of 0 drops
+// all the entries after the first ones.
+func New(first, thereafter uint64, tick time.Duration) *Sampler {
+	return &Sampler{
+		first:      first,
+		thereafter: thereafter,
+		tick:       tick,
+		counts:     make(map[key]uint64),
+		dropped:    make(map[key]uint64),
+		pending:    make(map[key]uint64),
+		now:        time.Now,
+		done:       make(chan struct{}),
+	}
+}
+
+// WithSummary sets a function called for each message with dropped
+// entries in the ended intervals. Summary formats it as a log line.
+//
+// The summaries are reported at every tick by a ticker running
+// until Close is called, and by Flush, never from the hook: fn
+// can log to any logger, including the one running this sampler.
+func (s *Sampler) WithSummary(fn func(msg string, suppressed uint64)) *Sampler {
+	s.mu.Lock()
+	s.summary = fn
+	s.mu.Unlock()
+
+	if fn != nil && s.tick > 0 {
+		s.ticking.Do(s.run)
+	}
+	return s
+}
+
+// run flushes the sampler at every tick
+func (s *Sampler) run() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Flush()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Hook skips the entries over the sampling limits
+func (s *Sampler) Hook(v interface{}, msg string) (interface{}, string, error) {
+	k := key{msg: msg}
+	if leveler, ok := level.GetLeveler(v); ok {
+		k.level = leveler.Level()
+	}
+
+	if !s.sample(k) {
+		return v, msg, genelog.ErrSkip
+	}
+	return v, msg, nil
+}
+
+// sample counts the entry and returns true if it must be logged
+func (s *Sampler) sample(k key) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.start) >= s.tick {
+		s.rotate(now)
+	}
+
+	s.counts[k]++
+	n := s.counts[k]
+
+	if n <= s.first {
+		return true
+	}
+	if s.thereafter > 0 && (n-s.first)%s.thereafter == 0 {
+		return true
+	}
+
+	s.dropped[k]++
+	return false
+}
+
+// Flush reports the dropped entries and starts a new interval
+func (s *Sampler) Flush() {
+	s.mu.Lock()
+	s.rotate(s.now())
+	pending, summary := s.pending, s.summary
+	s.pending = make(map[key]uint64)
+	s.mu.Unlock()
+
+	// reported unlocked, the summary being free to log
+	if summary != nil {
+		for k, n := range pending {
+			summary(k.msg, n)
+		}
+	}
+}
+
+// Close stops the ticker and reports the dropped entries.
+// The sampler keeps sampling, the summaries being reported
+// by Flush only.
+func (s *Sampler) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.Flush()
+	return nil
+}
+
+// rotate starts a new interval, keeping the dropped entries
+// of the previous one to report if there is a summary
+func (s *Sampler) rotate(now time.Time) {
+	if s.summary != nil {
+		for k, n := range s.dropped {
+			s.pending[k] += n
+		}
+	}
+
+	s.start = now
+	s.counts = make(map[key]uint64)
+	s.dropped = make(map[key]uint64)
+}
+
+// Summary returns a summary function writing a line
+// "<msg>: N similar messages suppressed" to logger.
+func Summary(logger *genelog.Logger) func(msg string, suppressed uint64) {
+	return func(msg string, suppressed uint64) {
+		logger.Println(fmt.Sprintf("%s: %d similar messages suppressed", msg, suppressed))
+	}
+}
+
+// NewHookRandom returns a hook keeping entries with
+// the probability rate, between 0 and 1.
+func NewHookRandom(rate float64) genelog.Hook {
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		mu.Lock()
+		keep := r.Float64() < rate
+		mu.Unlock()
+
+		if !keep {
+			return v, msg, genelog.ErrSkip
+		}
+		return v, msg, nil
+	}
+}
+
+// NewHookLevels returns a hook applying a sampling hook per level.
+// Entries with a level not in hooks are kept.
+func NewHookLevels(hooks map[level.Level]genelog.Hook) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := level.GetLeveler(v)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Leveler interface", v)
+		}
+
+		hook, ok := hooks[context.Level()]
+		if !ok {
+			return v, msg, nil
+		}
+		return hook(v, msg)
+	}
+}
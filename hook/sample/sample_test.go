@@ -0,0 +1,201 @@
+package sample
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+func ExampleSampler() {
+	buf := bytes.Buffer{}
+
+	sampler := New(2, 3, time.Minute)
+
+	logger := genelog.New(&buf).
+		AddHook(sampler.Hook)
+
+	for i := 0; i < 10; i++ {
+		logger.Println("hot loop")
+	}
+
+	fmt.Print(&buf)
+
+	// Output:
+	// hot loop
+	// hot loop
+	// hot loop
+	// hot loop
+}
+
+func TestSampler_interval(t *testing.T) {
+	buf := bytes.Buffer{}
+	summary := bytes.Buffer{}
+
+	now := time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	sampler := New(1, 0, time.Second).
+		WithSummary(Summary(genelog.New(&summary)))
+	defer sampler.Close()
+	sampler.now = func() time.Time { return now }
+
+	logger := genelog.New(&buf).
+		AddHook(sampler.Hook)
+
+	logger.Println("a")
+	logger.Println("a")
+	logger.Println("b")
+	logger.Println("a")
+
+	now = now.Add(time.Second)
+	logger.Println("a")
+
+	if want, got := "a\nb\na\n", buf.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	// reported by Flush only
+	if summary.Len() != 0 {
+		t.Fatalf("want no summary before Flush, got: %q", summary.String())
+	}
+	sampler.Flush()
+	if want, got := "a: 2 similar messages suppressed\n", summary.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	summary.Reset()
+	logger.Println("a")
+	logger.Println("a")
+	sampler.Flush()
+	if want, got := "a: 1 similar messages suppressed\n", summary.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestSummary_parent(t *testing.T) {
+	buf := bytes.Buffer{}
+	root := genelog.New(&buf)
+
+	// the summary logs to the parent of the sampled logger,
+	// sharing its write lock
+	now := time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	sampler := New(1, 0, time.Second)
+	sampler.now = func() time.Time { return now }
+	sampler.WithSummary(Summary(root))
+	defer sampler.Close()
+
+	logger := root.AddHook(sampler.Hook)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Println("a")
+		logger.Println("a")
+		// the interval ends on an entry
+		now = now.Add(time.Second)
+		logger.Println("b")
+		sampler.Flush()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deadlock")
+	}
+
+	if want, got := "a\nb\na: 1 similar messages suppressed\n", buf.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestSampler_ticker(t *testing.T) {
+	summaries := make(chan string, 10)
+	sampler := New(1, 0, 10*time.Millisecond).
+		WithSummary(func(msg string, suppressed uint64) {
+			summaries <- fmt.Sprintf("%s: %d", msg, suppressed)
+		})
+
+	logger := genelog.New(io.Discard).
+		AddHook(sampler.Hook)
+
+	logger.Println("a")
+	logger.Println("a")
+	logger.Println("a")
+
+	// reported without a later entry
+	select {
+	case got := <-summaries:
+		if want := "a: 2"; got != want {
+			t.Fatalf("want: %q, got: %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("summary not reported by the ticker")
+	}
+
+	// after Close, the summaries are reported on Flush only
+	if err := sampler.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Println("b")
+	logger.Println("b")
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case got := <-summaries:
+		t.Fatalf("want no summary after Close, got: %q", got)
+	default:
+	}
+
+	sampler.Flush()
+	if got, want := <-summaries, "b: 1"; got != want {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+type exampleWithLevel struct {
+	*level.WithLevel
+}
+
+func TestNewHookLevels(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	context := exampleWithLevel{
+		level.NewWithLevel(level.DEBUG),
+	}
+
+	logger := level.NewLevelLogger(&buf).
+		WithContext(context).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			context, _ := v.(exampleWithLevel)
+			return fmt.Sprintf("%s: %s\n", context.Level(), msg), nil
+		}).
+		AddHook(NewHookLevels(map[level.Level]genelog.Hook{
+			level.DEBUG: NewHookRandom(0),
+		}))
+
+	for i := 0; i < 3; i++ {
+		logger.Debug("mylog")
+		logger.Info("mylog")
+	}
+
+	if want, got := "info: mylog\ninfo: mylog\ninfo: mylog\n", buf.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestNewHookRandom(t *testing.T) {
+	hook := NewHookRandom(0.5)
+
+	var kept int
+	for i := 0; i < 1000; i++ {
+		if _, _, err := hook(nil, "msg"); err == nil {
+			kept++
+		}
+	}
+
+	if kept < 350 || kept > 650 {
+		t.Fatalf("kept %d entries out of 1000 at rate 0.5", kept)
+	}
+}
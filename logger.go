@@ -6,7 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -27,9 +31,106 @@ type Update func(context interface{}) (newcontext interface{}, err error)
 // If err is ErrSkip, just return without writing anything
 type Hook func(context interface{}, msg string) (newcontext interface{}, newmsg string, err error)
 
+// NamedHook is a hook of a logger with its name,
+// empty for the hooks added with AddHook
+type NamedHook struct {
+	Name string
+	Hook Hook
+	// failures counts the consecutive failures of the hook
+	failures *int64
+	// ordered is true for the hooks added with AddOrderedHook
+	ordered bool
+}
+
+func newNamedHook(name string, h Hook) NamedHook {
+	return NamedHook{Name: name, Hook: h, failures: new(int64)}
+}
+
+// PanicError is the error of a panic recovered
+// in a hook, a formatter or a writer
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// QuarantineError reports a hook disabled after its failures
+type QuarantineError struct {
+	// Hook is the name of the hook, or its position
+	// for the hooks added with AddHook
+	Hook string
+	// Failures is the number of consecutive failures
+	Failures int
+	// Err is the last error of the hook
+	Err error
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("hook %s quarantined after %d failures: %s", e.Hook, e.Failures, e.Err)
+}
+
+func (e *QuarantineError) Unwrap() error {
+	return e.Err
+}
+
+// Stage is the step of the pipeline where an entry ended
+type Stage int
+
+const (
+	// StageHook is the end of an entry skipped or failed by a hook
+	StageHook Stage = iota
+	// StageFormat is the end of an entry failed by the formatter
+	StageFormat
+	// StageWrite is the end of an entry passed to the writer
+	StageWrite
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageHook:
+		return "hook"
+	case StageFormat:
+		return "format"
+	case StageWrite:
+		return "write"
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
+
+// Result describes what happened to an entry
+type Result struct {
+	// Stage is where the entry ended
+	Stage Stage
+	// Context is the context after the hooks
+	Context interface{}
+	// Message is the message after the hooks
+	Message string
+	// Output is the formatted entry, without the newline
+	// added by Println and Write
+	Output string
+	// N is the number of bytes written
+	N int
+	// Err is ErrSkip if a hook skipped the entry,
+	// or the error of a hook, the formatter or the writer
+	Err error
+	// Duration is the time spent writing
+	Duration time.Duration
+}
+
+// Observer is called after each entry with its result
+type Observer func(r Result)
+
+// writeFunc writes a formatted entry
+type writeFunc func(w io.Writer, s string) (int, error)
+
 type Logger struct {
-	// mu synchronizes writes
-	mu sync.Mutex
+	// mu serializes the writes, shared by the logger and its clones
+	mu *sync.Mutex
+	// contextMu synchronizes the context
+	contextMu sync.RWMutex
 	// w writes the logs somewhere
 	w io.Writer
 	// context adds metadata to logs
@@ -37,48 +138,118 @@ type Logger struct {
 	// formatter is a function to shape the log output
 	format Format
 	// hooks updates the context and message on every writes
-	hooks []Hook
+	hooks []NamedHook
+	// branches receive the entries instead of w when set by Tee
+	branches []*Logger
+	// route returns the logger receiving the entries instead of w
+	// when set by Route
+	route func() (*Logger, func())
+	// observers are called after every entries
+	observers []Observer
+	// quarantine is the number of consecutive failures
+	// disabling a hook, 0 to never disable hooks
+	quarantine int
 }
 
 func New(w io.Writer) *Logger {
 	return &Logger{
+		mu:    &sync.Mutex{},
 		w:     w,
-		hooks: make([]Hook, 0),
+		hooks: make([]NamedHook, 0),
 	}
 }
 
 func (l *Logger) clone() *Logger {
 	logger := New(l.w)
-	logger.context = l.context
+	logger.mu = l.mu
+	logger.context = l.Context()
 	logger.format = l.format
 	logger.hooks = l.hooks
+	logger.branches = l.branches
+	logger.route = l.route
+	logger.observers = l.observers
+	logger.quarantine = l.quarantine
 
 	return logger
 }
 
+// Tee returns a logger writing each entry to all the branches.
+//
+// The hooks of the returned logger run once per entry, then each
+// branch runs its own hooks, formatter and writer on the resulting
+// context and message. The context of the branches is not used.
+//
+// An error in a branch, reported to its writer, does not prevent
+// the other branches from being written.
+func Tee(branches ...*Logger) *Logger {
+	logger := New(io.Discard)
+	logger.branches = branches
+	return logger
+}
+
+// Route returns a logger writing each entry to the logger returned
+// by current, called for every entry.
+//
+// Like with Tee, the hooks of the returned logger run first, then
+// the hooks, formatter and writer of the current logger. Changing
+// the logger returned by current changes the output of all the
+// loggers derived from the returned one with WithContext or AddHook.
+func Route(current func() *Logger) *Logger {
+	return RouteRelease(func() (*Logger, func()) {
+		return current(), nil
+	})
+}
+
+// RouteRelease is like Route, current also returning a function
+// called once the entry is written to the returned logger, if not
+// nil. It allows the owner of the current logger to wait for the
+// entries in progress before closing it.
+func RouteRelease(current func() (logger *Logger, release func())) *Logger {
+	logger := New(io.Discard)
+	logger.route = current
+	return logger
+}
+
 // Print uses fmt.Print to write to the logger
 func (l *Logger) Print(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	l.write(msg, func(w io.Writer, s string) {
-		_, _ = io.WriteString(w, s)
-	})
+	l.write(nil, fmt.Sprint(v...), writeString)
 }
 
 // Println uses fmt.Println to write to the logger
 func (l *Logger) Println(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	l.write(msg, func(w io.Writer, s string) {
-		_, _ = io.WriteString(w, s)
-		_, _ = io.WriteString(w, "\n")
-	})
+	l.write(nil, fmt.Sprint(v...), writeLine)
 }
 
 // Printf uses fmt.Printf to write to the logger
 func (l *Logger) Printf(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	l.write(msg, func(w io.Writer, s string) {
-		_, _ = io.WriteString(w, s)
-	})
+	l.write(nil, fmt.Sprintf(format, v...), writeString)
+}
+
+// PrintWith is like Print, h being called on the entry before the
+// hooks of the logger, like a hook added with PrependHook but
+// without cloning the logger
+func (l *Logger) PrintWith(h Hook, v ...interface{}) {
+	l.write(h, fmt.Sprint(v...), writeString)
+}
+
+// PrintlnWith is like Println, h being called on the entry
+// before the hooks of the logger
+func (l *Logger) PrintlnWith(h Hook, v ...interface{}) {
+	l.write(h, fmt.Sprint(v...), writeLine)
+}
+
+// PrintfWith is like Printf, h being called on the entry
+// before the hooks of the logger
+func (l *Logger) PrintfWith(h Hook, format string, v ...interface{}) {
+	l.write(h, fmt.Sprintf(format, v...), writeString)
+}
+
+func writeString(w io.Writer, s string) (int, error) {
+	return io.WriteString(w, s)
+}
+
+func writeLine(w io.Writer, s string) (int, error) {
+	return io.WriteString(w, s+"\n")
 }
 
 // WithContext adds a context to the logger
@@ -90,6 +261,8 @@ func (l *Logger) WithContext(v interface{}) *Logger {
 
 // Context returns the context
 func (l *Logger) Context() interface{} {
+	l.contextMu.RLock()
+	defer l.contextMu.RUnlock()
 	return l.context
 }
 
@@ -102,17 +275,157 @@ func (l *Logger) WithFormatter(f Format) *Logger {
 
 // AddHook adds a hook function to the list of hooks of the logger.
 //
-// Hooks are called in the added order
+// Hooks are called in the added order, concurrently on a copy of
+// the context made for each entry by CopyContext, or one entry at a
+// time for the logger and its clones if the context can't be copied.
 func (l *Logger) AddHook(h Hook) *Logger {
 	logger := l.clone()
-	logger.hooks = append(logger.hooks, h)
+	logger.hooks = append(logger.hooks[:len(logger.hooks):len(logger.hooks)], newNamedHook("", h))
+	return logger
+}
+
+// AddOrderedHook adds a hook function called with the write lock held,
+// like the hooks after it and the formatter, so that the entries are
+// written in the order they go through it. It is meant for hooks like
+// seq.NewHookSeq with the contexts copied by CopyContext, the
+// entries of the other contexts being always serialized.
+func (l *Logger) AddOrderedHook(h Hook) *Logger {
+	hook := newNamedHook("", h)
+	hook.ordered = true
+
+	logger := l.clone()
+	logger.hooks = append(logger.hooks[:len(logger.hooks):len(logger.hooks)], hook)
+	return logger
+}
+
+// PrependHook adds a hook function called before the other hooks
+func (l *Logger) PrependHook(h Hook) *Logger {
+	logger := l.clone()
+	hooks := make([]NamedHook, 0, len(logger.hooks)+1)
+	logger.hooks = append(append(hooks, newNamedHook("", h)), logger.hooks...)
+	return logger
+}
+
+// AddNamedHook adds a hook function named name to the list of hooks
+// of the logger. A hook already named name is replaced in place.
+func (l *Logger) AddNamedHook(name string, h Hook) *Logger {
+	logger := l.clone()
+	if i := logger.hookIndex(name); i >= 0 {
+		hooks := make([]NamedHook, len(logger.hooks))
+		copy(hooks, logger.hooks)
+		hooks[i] = newNamedHook(name, h)
+		logger.hooks = hooks
+		return logger
+	}
+	logger.hooks = append(logger.hooks[:len(logger.hooks):len(logger.hooks)], newNamedHook(name, h))
+	return logger
+}
+
+// InsertHookBefore adds a hook function named name before the hook
+// named before. If no hook is named before, h is added last.
+func (l *Logger) InsertHookBefore(before, name string, h Hook) *Logger {
+	i := l.hookIndex(before)
+	if i < 0 {
+		return l.AddNamedHook(name, h)
+	}
+	return l.insertHook(i, name, h)
+}
+
+// InsertHookAfter adds a hook function named name after the hook
+// named after. If no hook is named after, h is added last.
+func (l *Logger) InsertHookAfter(after, name string, h Hook) *Logger {
+	i := l.hookIndex(after)
+	if i < 0 {
+		return l.AddNamedHook(name, h)
+	}
+	return l.insertHook(i+1, name, h)
+}
+
+// RemoveHook removes the hooks named name
+func (l *Logger) RemoveHook(name string) *Logger {
+	logger := l.clone()
+	hooks := make([]NamedHook, 0, len(logger.hooks))
+	for _, hook := range logger.hooks {
+		if hook.Name != name || name == "" {
+			hooks = append(hooks, hook)
+		}
+	}
+	logger.hooks = hooks
+	return logger
+}
+
+// Hooks returns a copy of the hooks of the logger, in the call order
+func (l *Logger) Hooks() []NamedHook {
+	hooks := make([]NamedHook, len(l.hooks))
+	copy(hooks, l.hooks)
+	return hooks
+}
+
+// insertHook returns a logger with h inserted at position i,
+// a hook already named name being moved
+func (l *Logger) insertHook(i int, name string, h Hook) *Logger {
+	logger := l.clone()
+	hooks := make([]NamedHook, 0, len(logger.hooks)+1)
+	for j, hook := range logger.hooks {
+		if j == i {
+			hooks = append(hooks, newNamedHook(name, h))
+		}
+		if hook.Name != name || name == "" {
+			hooks = append(hooks, hook)
+		}
+	}
+	if i == len(logger.hooks) {
+		hooks = append(hooks, newNamedHook(name, h))
+	}
+	logger.hooks = hooks
+	return logger
+}
+
+// hookIndex returns the position of the hook named name, or -1
+func (l *Logger) hookIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, hook := range l.hooks {
+		if hook.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// WithQuarantine disables the hooks failing failures times in a row,
+// with an error or a panic, for the logger and the loggers sharing
+// them. The entries are then logged without the disabled hooks.
+// 0 never disables hooks, the default.
+func (l *Logger) WithQuarantine(failures int) *Logger {
+	logger := l.clone()
+	logger.quarantine = failures
+	return logger
+}
+
+// AddObserver adds an observer function to the list of observers
+// of the logger.
+//
+// Observers are called in the added order after each entry written
+// to the writer of the logger, or skipped or failed before. With Tee
+// and Route, the results of the writes are observed by the observers
+// of the loggers receiving the entries. Observers are called
+// concurrently by the goroutines writing when the context
+// is copied by CopyContext.
+func (l *Logger) AddObserver(o Observer) *Logger {
+	logger := l.clone()
+	logger.observers = append(logger.observers[:len(logger.observers):len(logger.observers)], o)
 	return logger
 }
 
 // UpdateContext updates the logger context with the update function
 func (l *Logger) UpdateContext(update Update) error {
+	// the update may change the values shared with the entries
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.contextMu.Lock()
+	defer l.contextMu.Unlock()
 	context, err := update(l.context)
 	if err != nil {
 		return err
@@ -129,42 +442,238 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 	scanner := bufio.NewScanner(buf)
 
 	for scanner.Scan() {
-		l.write(scanner.Text(), func(w io.Writer, s string) {
-			_, err = fmt.Fprintln(w, s)
+		l.write(nil, scanner.Text(), func(w io.Writer, s string) (int, error) {
+			return fmt.Fprintln(w, s)
 		})
 	}
 
 	return size - buf.Len(), scanner.Err()
 }
 
-func (l *Logger) write(msg string, fn func(w io.Writer, s string)) {
-	var err error
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// write passes an entry through the logger, with a copy of the
+// context made by CopyContext, first calling h if not nil
+func (l *Logger) write(h Hook, msg string, fn writeFunc) {
+	context, copied := CopyContext(l.Context())
+
+	var held *sync.Mutex
+	if !copied {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		held = l.mu
+	}
 
-	// Apply hook if any
-	for _, hook := range l.hooks {
-		l.context, msg, err = hook(l.context, msg)
+	if h != nil {
+		newcontext, newmsg, err := callHook(h, context, msg)
 		if err != nil {
-			if errors.Is(err, ErrSkip) {
-				return
+			if !errors.Is(err, ErrSkip) {
+				l.report(err, held)
 			}
-			fmt.Fprintf(l.w, "%s: %s\n", ErrLogger, err)
+			l.observe(Result{Stage: StageHook, Context: newcontext, Message: newmsg, Err: err})
 			return
 		}
+		context, msg = newcontext, newmsg
+	}
+
+	l.writeBranch(context, msg, fn, held, copied)
+}
+
+// writeBranch writes an entry, coming from a Tee or Route logger
+// or not. held is the write lock held by the caller, if any, and
+// copied is true if the context is a copy made for the entry.
+//
+// The entries of the contexts not copied are serialized from the
+// hooks, the other ones from the first ordered hook.
+func (l *Logger) writeBranch(context interface{}, msg string, fn writeFunc, held *sync.Mutex, copied bool) {
+	if !copied && held != l.mu {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		held = l.mu
+	}
+
+	context, msg, locked, err := l.hook(context, msg, held)
+	if locked {
+		defer l.mu.Unlock()
+		held = l.mu
+	}
+	if err != nil {
+		if !errors.Is(err, ErrSkip) {
+			l.report(err, held)
+		}
+		l.observe(Result{Stage: StageHook, Context: context, Message: msg, Err: err})
+		return
 	}
 
+	l.dispatch(context, msg, fn, held, copied)
+}
+
+// dispatch passes an entry to the branches or the route if any,
+// or outputs it
+func (l *Logger) dispatch(context interface{}, msg string, fn writeFunc, held *sync.Mutex, copied bool) {
+	if len(l.branches) > 0 {
+		for _, branch := range l.branches {
+			branch.writeBranch(context, msg, fn, held, copied)
+		}
+		return
+	}
+
+	if l.route != nil {
+		logger, release := l.route()
+		if release != nil {
+			defer release()
+		}
+		if logger != nil {
+			logger.writeBranch(context, msg, fn, held, copied)
+		}
+		return
+	}
+
+	l.output(context, msg, fn, held)
+}
+
+// hook applies the hooks in the added order, the quarantined
+// ones excepted. locked is true if the write lock was taken
+// for an ordered hook, and must be released by the caller.
+func (l *Logger) hook(context interface{}, msg string, held *sync.Mutex) (_ interface{}, _ string, locked bool, _ error) {
+	for i, hook := range l.hooks {
+		if l.quarantine > 0 && hook.failures != nil &&
+			atomic.LoadInt64(hook.failures) >= int64(l.quarantine) {
+			continue
+		}
+
+		if hook.ordered && !locked && held != l.mu {
+			l.mu.Lock()
+			locked = true
+		}
+
+		newcontext, newmsg, err := callHook(hook.Hook, context, msg)
+		if err == nil || errors.Is(err, ErrSkip) {
+			if hook.failures != nil {
+				atomic.StoreInt64(hook.failures, 0)
+			}
+			if err != nil {
+				return newcontext, newmsg, locked, err
+			}
+			context, msg = newcontext, newmsg
+			continue
+		}
+
+		if hook.failures != nil {
+			failures := atomic.AddInt64(hook.failures, 1)
+			if l.quarantine > 0 && failures == int64(l.quarantine) {
+				name := hook.Name
+				if name == "" {
+					name = fmt.Sprintf("#%d", i)
+				}
+				err = &QuarantineError{Hook: name, Failures: l.quarantine, Err: err}
+			}
+		}
+		return context, msg, locked, err
+	}
+	return context, msg, locked, nil
+}
+
+// callHook calls h, recovering its panics
+func callHook(h Hook, context interface{}, msg string) (newcontext interface{}, newmsg string, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			newcontext, newmsg, err = context, msg, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return h(context, msg)
+}
+
+// callFormat calls f, recovering its panics
+func callFormat(f Format, context interface{}, msg string) (out string, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			out, err = "", &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return f(context, msg)
+}
+
+// callWrite calls fn, recovering the panics of the writer
+func callWrite(fn writeFunc, w io.Writer, s string) (n int, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			n, err = 0, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn(w, s)
+}
+
+// writeLocked writes out to the writer with the write lock held
+func (l *Logger) writeLocked(fn writeFunc, out string, held *sync.Mutex) (int, error) {
+	if held != l.mu {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+	return callWrite(fn, l.w, out)
+}
+
+// reportPanic reports the panics of the writer, the other write
+// errors being left to the observers as before
+func (l *Logger) reportPanic(err error, held *sync.Mutex) {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		l.report(err, held)
+	}
+}
+
+// report writes err to the writer of the logger,
+// ignoring the panics of the writer
+func (l *Logger) report(err error, held *sync.Mutex) {
+	if held != l.mu {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+	defer func() {
+		_ = recover()
+	}()
+	fmt.Fprintf(l.w, "%s: %s\n", ErrLogger, err)
+}
+
+// output formats and writes an entry
+func (l *Logger) output(context interface{}, msg string, fn writeFunc, held *sync.Mutex) {
+	out := msg
+
 	// Apply formatter if any
 	if l.format != nil {
-		msg, err = l.format(l.context, msg)
+		var err error
+		out, err = callFormat(l.format, context, msg)
 		if err != nil {
-			fmt.Fprintf(l.w, "%s: %s\n", ErrLogger, err)
+			l.report(err, held)
+			l.observe(Result{Stage: StageFormat, Context: context, Message: msg, Err: err})
 			return
 		}
 	}
 
 	// Process output
-	fn(l.w, msg)
+	if len(l.observers) == 0 {
+		_, err := l.writeLocked(fn, out, held)
+		l.reportPanic(err, held)
+		return
+	}
+
+	start := time.Now()
+	n, err := l.writeLocked(fn, out, held)
+	l.reportPanic(err, held)
+	l.observe(Result{
+		Stage:    StageWrite,
+		Context:  context,
+		Message:  msg,
+		Output:   out,
+		N:        n,
+		Err:      err,
+		Duration: time.Since(start),
+	})
+}
+
+// observe calls the observers with the result of an entry
+func (l *Logger) observe(r Result) {
+	for _, observer := range l.observers {
+		observer(r)
+	}
 }
 
 // SetOutput changes the output writer of the logger
@@ -173,3 +682,127 @@ func (l *Logger) SetOutput(w io.Writer) {
 	defer l.mu.Unlock()
 	l.w = w
 }
+
+// flusher is implemented by writers buffering entries
+type flusher interface {
+	Flush() error
+}
+
+// syncer is implemented by writers committing entries to storage,
+// like *os.File, or waiting for them to be sent
+type syncer interface {
+	Sync() error
+}
+
+// Sync flushes the entries buffered by the writer of the logger,
+// then commits them to storage, when the writer implements
+// Flush() error or Sync() error. A Flush() method without error,
+// queuing the entries to send without waiting for them, is not
+// called: such writers wait for their entries in their Sync method.
+//
+// Flush is called with the write lock held, like Write. Sync is
+// called without it, the entries going on being written while it
+// waits: it must be safe for concurrent use with Write, like the
+// Sync methods of *os.File and the sinks.
+//
+// With Tee, the branches are synced, and with Route, the current
+// logger. os.Stdout and os.Stderr are not synced, as terminals and
+// pipes don't support it.
+func (l *Logger) Sync() error {
+	if len(l.branches) > 0 {
+		var err error
+		for _, branch := range l.branches {
+			if e := branch.Sync(); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+
+	if l.route != nil {
+		logger, release := l.route()
+		if release != nil {
+			defer release()
+		}
+		if logger != nil {
+			return logger.Sync()
+		}
+		return nil
+	}
+
+	_, err := l.syncOutput()
+	return err
+}
+
+// syncOutput flushes the writer with the write lock held, then
+// syncs it without, and returns it
+func (l *Logger) syncOutput() (io.Writer, error) {
+	l.mu.Lock()
+	w := l.w
+	err := flushWriter(w)
+	l.mu.Unlock()
+
+	if e := syncWriter(w); e != nil && err == nil {
+		err = e
+	}
+	return w, err
+}
+
+// Close syncs then closes the writer of the logger when it
+// implements io.Closer. The writer is shared by the clones of the
+// logger, which must not be used after.
+//
+// With Tee, the branches are closed. With Route, the current logger
+// is only synced, as it is owned by the function returning it.
+// os.Stdout and os.Stderr are not closed.
+func (l *Logger) Close() error {
+	if len(l.branches) > 0 {
+		var err error
+		for _, branch := range l.branches {
+			if e := branch.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+
+	if l.route != nil {
+		return l.Sync()
+	}
+
+	w, err := l.syncOutput()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if closer, ok := w.(io.Closer); ok && !isStd(w) {
+		// the writer is already closed by a branch sharing it
+		if e := closer.Close(); e != nil && !errors.Is(e, os.ErrClosed) && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// flushWriter flushes w
+func flushWriter(w io.Writer) error {
+	if f, ok := w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// syncWriter syncs w
+func syncWriter(w io.Writer) error {
+	if s, ok := w.(syncer); ok && !isStd(w) {
+		if err := s.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// isStd returns true for os.Stdout and os.Stderr
+func isStd(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && (f == os.Stdout || f == os.Stderr)
+}
@@ -2,11 +2,17 @@ package genelog
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -288,3 +294,772 @@ func ExampleLogger_SetOutput() {
 	// Output:
 	// mylog2
 }
+
+func ExampleTee() {
+	text := bytes.Buffer{}
+	jsonText := bytes.Buffer{}
+
+	logger := Tee(
+		New(&text).
+			WithFormatter(func(v interface{}, msg string) (string, error) {
+				return fmt.Sprintf("%v: %s", v, msg), nil
+			}),
+		New(&jsonText).
+			WithFormatter(func(v interface{}, msg string) (string, error) {
+				out, err := json.Marshal(map[string]interface{}{"context": v, "message": msg})
+				return string(out), err
+			}),
+	).WithContext("mycontext")
+
+	logger.Println("mylog")
+
+	fmt.Print(&text)
+	fmt.Print(&jsonText)
+
+	// Output:
+	// mycontext: mylog
+	// {"context":"mycontext","message":"mylog"}
+}
+
+func TestTee(t *testing.T) {
+	ok := bytes.Buffer{}
+	failing := bytes.Buffer{}
+	skipped := bytes.Buffer{}
+
+	var calls int
+	logger := Tee(
+		New(&failing).
+			WithFormatter(func(v interface{}, msg string) (string, error) {
+				return "", errors.New("format failed")
+			}),
+		New(&skipped).
+			AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+				return v, msg, ErrSkip
+			}),
+		New(&ok).
+			WithFormatter(func(v interface{}, msg string) (string, error) {
+				return fmt.Sprintf("%v: %s", v, msg), nil
+			}),
+	).
+		WithContext(0).
+		AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+			calls++
+			return calls, msg, nil
+		})
+
+	logger.Println("mylog1")
+	logger.Println("mylog2")
+
+	if want, got := 2, calls; want != got {
+		t.Fatalf("shared hook calls: want: %d, got: %d", want, got)
+	}
+
+	if want, got := "1: mylog1\n2: mylog2\n", ok.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	if want, got := "logger error: format failed\nlogger error: format failed\n", failing.String(); want != got {
+		t.Fatalf("\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	if got := skipped.String(); got != "" {
+		t.Fatalf("%s: want empty output", got)
+	}
+}
+
+func ExampleRoute() {
+	current := New(os.Stdout).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return fmt.Sprintf("first: %v: %s", v, msg), nil
+		})
+
+	logger := Route(func() *Logger { return current }).
+		WithContext("mycontext")
+
+	logger.Println("mylog1")
+
+	current = New(os.Stdout).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return fmt.Sprintf("second: %v: %s", v, msg), nil
+		})
+
+	logger.Println("mylog2")
+
+	// Output:
+	// first: mycontext: mylog1
+	// second: mycontext: mylog2
+}
+
+func ExampleRouteRelease() {
+	current := New(os.Stdout)
+
+	logger := RouteRelease(func() (*Logger, func()) {
+		fmt.Println("acquired")
+		return current, func() { fmt.Println("released") }
+	})
+
+	logger.Println("mylog")
+
+	// Output:
+	// acquired
+	// mylog
+	// released
+}
+
+func ExampleLogger_AddObserver() {
+	var written, skipped int
+
+	logger := New(io.Discard).
+		AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+			if msg == "noise" {
+				return v, msg, ErrSkip
+			}
+			return v, msg, nil
+		}).
+		AddObserver(func(r Result) {
+			if errors.Is(r.Err, ErrSkip) {
+				skipped++
+				return
+			}
+			written += r.N
+		})
+
+	logger.Println("mylog")
+	logger.Println("noise")
+
+	fmt.Println(written, skipped)
+
+	// Output:
+	// 6 1
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestLogger_AddObserver(t *testing.T) {
+	results := make([]Result, 0)
+	observe := func(r Result) {
+		results = append(results, r)
+	}
+
+	ok := New(io.Discard).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			if msg == "bad" {
+				return "", errors.New("format failed")
+			}
+			return fmt.Sprintf("%v: %s", v, msg), nil
+		}).
+		AddObserver(observe)
+
+	logger := Tee(ok, New(failingWriter{}).AddObserver(observe)).
+		WithContext("ctx").
+		AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+			if msg == "skip" {
+				return v, msg, ErrSkip
+			}
+			return v, msg, nil
+		}).
+		AddObserver(observe)
+
+	logger.Println("mylog")
+	logger.Println("skip")
+	logger.Println("bad")
+
+	want := []string{
+		// mylog written by both branches
+		`write ctx "mylog" "ctx: mylog" 11 <nil>`,
+		`write ctx "mylog" "mylog" 0 write failed`,
+		// skip observed by the tee
+		`hook ctx "skip" "" 0 skip`,
+		// bad fails in the formatter of the first branch
+		`format ctx "bad" "" 0 format failed`,
+		`write ctx "bad" "bad" 0 write failed`,
+	}
+
+	if len(results) != len(want) {
+		t.Fatalf("want %d results, got: %+v", len(want), results)
+	}
+	for i, r := range results {
+		got := fmt.Sprintf("%s %v %q %q %d %v", r.Stage, r.Context, r.Message, r.Output, r.N, r.Err)
+		if got != want[i] {
+			t.Fatalf("%d:\nwant: %s\ngot:  %s", i, want[i], got)
+		}
+	}
+}
+
+func TestLogger_AddObserver_siblings(t *testing.T) {
+	var observed []string
+	observer := func(name string) Observer {
+		return func(Result) { observed = append(observed, name) }
+	}
+
+	base := New(io.Discard).
+		AddObserver(observer("1")).
+		AddObserver(observer("2")).
+		AddObserver(observer("3"))
+	a := base.AddObserver(observer("a"))
+	b := base.AddObserver(observer("b"))
+
+	testSuite := map[string]struct {
+		logger *Logger
+		want   string
+	}{
+		"a": {a, "[1 2 3 a]"},
+		"b": {b, "[1 2 3 b]"},
+	}
+
+	for name, test := range testSuite {
+		observed = nil
+		test.logger.Println("mylog")
+		if got := fmt.Sprint(observed); got != test.want {
+			t.Fatalf("%s: want: %s, got: %s", name, test.want, got)
+		}
+	}
+}
+
+func ExampleLogger_InsertHookBefore() {
+	suffix := func(s string) Hook {
+		return func(v interface{}, msg string) (interface{}, string, error) {
+			return v, msg + s, nil
+		}
+	}
+
+	logger := New(os.Stdout).
+		AddNamedHook("a", suffix(" a")).
+		AddNamedHook("c", suffix(" c")).
+		InsertHookBefore("c", "b", suffix(" b"))
+
+	logger.Println("hooks:")
+	logger.RemoveHook("a").Println("hooks:")
+
+	// Output:
+	// hooks: a b c
+	// hooks: b c
+}
+
+func TestLogger_hooks(t *testing.T) {
+	suffix := func(s string) Hook {
+		return func(v interface{}, msg string) (interface{}, string, error) {
+			return v, msg + s, nil
+		}
+	}
+
+	base := New(io.Discard).
+		AddNamedHook("a", suffix("a")).
+		AddHook(suffix("-")).
+		AddNamedHook("b", suffix("b"))
+
+	testSuite := map[string]struct {
+		logger *Logger
+		want   string
+		names  []string
+	}{
+		"base":               {base, "a-b", []string{"a", "", "b"}},
+		"replace":            {base.AddNamedHook("a", suffix("A")), "A-b", []string{"a", "", "b"}},
+		"before":             {base.InsertHookBefore("a", "c", suffix("c")), "ca-b", []string{"c", "a", "", "b"}},
+		"after":              {base.InsertHookAfter("b", "c", suffix("c")), "a-bc", []string{"a", "", "b", "c"}},
+		"move":               {base.InsertHookAfter("b", "a", suffix("A")), "-bA", []string{"", "b", "a"}},
+		"unknown reference":  {base.InsertHookBefore("x", "c", suffix("c")), "a-bc", []string{"a", "", "b", "c"}},
+		"remove":             {base.RemoveHook("a"), "-b", []string{"", "b"}},
+		"remove unknown":     {base.RemoveHook("x"), "a-b", []string{"a", "", "b"}},
+		"remove unnamed":     {base.RemoveHook(""), "a-b", []string{"a", "", "b"}},
+		"append after child": {base.AddHook(suffix("1")), "a-b1", []string{"a", "", "b", ""}},
+	}
+
+	// siblings do not share their hooks
+	base.AddHook(suffix("2"))
+
+	for name, test := range testSuite {
+		_, msg, _, err := test.logger.hook(nil, "", nil)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if msg != test.want {
+			t.Fatalf("%s: want: %q, got: %q", name, test.want, msg)
+		}
+
+		hooks := test.logger.Hooks()
+		names := make([]string, len(hooks))
+		for i, hook := range hooks {
+			names[i] = hook.Name
+		}
+		if fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Fatalf("%s: want: %q, got: %q", name, test.names, names)
+		}
+	}
+}
+
+type panicWriter struct{}
+
+func (panicWriter) Write(p []byte) (int, error) {
+	panic("writer panic")
+}
+
+func TestLogger_panic(t *testing.T) {
+	panicHook := func(v interface{}, msg string) (interface{}, string, error) {
+		if msg == "hook" {
+			panic("hook panic")
+		}
+		return v, msg, nil
+	}
+	panicFormat := func(v interface{}, msg string) (string, error) {
+		if msg == "format" {
+			panic("format panic")
+		}
+		return msg, nil
+	}
+
+	output := bytes.Buffer{}
+	var results []Result
+	logger := Tee(
+		New(&output).
+			WithFormatter(panicFormat).
+			AddHook(panicHook),
+		New(panicWriter{}).
+			AddObserver(func(r Result) { results = append(results, r) }),
+	)
+
+	logger.Println("hook")
+	logger.Println("format")
+	logger.Println("ok")
+
+	lines := strings.Split(output.String(), "\n")
+	for i, want := range []string{
+		"logger error: panic: hook panic",
+		"logger error: panic: format panic",
+	} {
+		found := false
+		for _, line := range lines {
+			found = found || line == want
+		}
+		if !found {
+			t.Fatalf("%d: want %q in:\n%s", i, want, output.String())
+		}
+	}
+	if !strings.HasSuffix(output.String(), "\nok\n") {
+		t.Fatalf("want ok written after the panics:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), "runtime/debug.Stack") {
+		t.Fatalf("want the stack in:\n%s", output.String())
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("want 3 results, got: %d", len(results))
+	}
+	for _, r := range results {
+		var panicErr *PanicError
+		if r.Stage != StageWrite || !errors.As(r.Err, &panicErr) || panicErr.Value != "writer panic" {
+			t.Fatalf("want a writer panic, got: %s %v", r.Stage, r.Err)
+		}
+	}
+}
+
+func TestLogger_WithQuarantine(t *testing.T) {
+	calls := 0
+	failing := func(v interface{}, msg string) (interface{}, string, error) {
+		calls++
+		if strings.HasPrefix(msg, "fail") {
+			return v, msg, errors.New("failed")
+		}
+		return v, msg, nil
+	}
+
+	output := bytes.Buffer{}
+	logger := New(&output).
+		WithQuarantine(2).
+		AddNamedHook("failing", failing)
+
+	logger.Println("fail 1")
+	logger.Println("ok 1")
+	logger.Println("fail 2")
+	logger.Println("fail 3")
+	logger.Println("fail 4")
+
+	want := "logger error: failed\n" +
+		"ok 1\n" +
+		"logger error: failed\n" +
+		"logger error: hook failing quarantined after 2 failures: failed\n" +
+		"fail 4\n"
+	if output.String() != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, output.String())
+	}
+	if calls != 4 {
+		t.Fatalf("want 4 calls, got: %d", calls)
+	}
+
+	// without quarantine, the hook is called again
+	logger.WithQuarantine(0).Println("fail 5")
+	if calls != 5 {
+		t.Fatalf("want 5 calls, got: %d", calls)
+	}
+}
+
+type copierContext struct {
+	N *int
+}
+
+func (c copierContext) Copy() interface{} {
+	n := *c.N
+	return copierContext{N: &n}
+}
+
+// CopierField is a context field copied with Copy, exported
+// like the fields of the field packages to be set by CopyContext
+type CopierField struct {
+	N int
+}
+
+func (f *CopierField) Copy() interface{} {
+	copied := *f
+	return &copied
+}
+
+// embeddingContext gets the Copy method of its field
+type embeddingContext struct {
+	*CopierField
+	Name string
+	Time time.Time
+}
+
+func TestCopyContext(t *testing.T) {
+	n := 1
+	field := &CopierField{N: 1}
+
+	testSuite := map[string]struct {
+		context interface{}
+		copied  bool
+		// shared returns true if the copy shares a value with the context
+		shared func(copy interface{}) bool
+	}{
+		"nil":    {nil, true, nil},
+		"string": {"ctx", true, nil},
+		"value":  {benchmarkContext{Level: "info"}, true, nil},
+		"copier": {copierContext{N: &n}, true, func(v interface{}) bool {
+			return v.(copierContext).N == &n
+		}},
+		"fields": {embeddingContext{CopierField: field, Name: "a"}, true, func(v interface{}) bool {
+			return v.(embeddingContext).CopierField == field
+		}},
+		"nil field": {embeddingContext{Name: "a"}, true, nil},
+		"pointer":   {&benchmarkContext{}, false, nil},
+		"shared":    {sharedContext{N: &n}, false, nil},
+		"map":       {struct{ M map[string]int }{}, false, nil},
+	}
+
+	for name, test := range testSuite {
+		got, copied := CopyContext(test.context)
+		if copied != test.copied {
+			t.Fatalf("%s: want copied: %t, got: %t", name, test.copied, copied)
+		}
+		if reflect.TypeOf(got) != reflect.TypeOf(test.context) {
+			t.Fatalf("%s: want type: %T, got: %T", name, test.context, got)
+		}
+		if test.shared != nil && test.shared(got) {
+			t.Fatalf("%s: the copy shares the fields of the context", name)
+		}
+	}
+}
+
+func TestLogger_concurrent(t *testing.T) {
+	const goroutines, lines = 16, 100
+
+	// bytes.Buffer is not safe for concurrent use:
+	// the clones must share the write lock
+	output := bytes.Buffer{}
+	logger := New(&output).
+		WithContext(copierContext{N: new(int)}).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return fmt.Sprintf("%d %s", *v.(copierContext).N, msg), nil
+		}).
+		AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+			context := v.(copierContext)
+			*context.N = len(msg)
+			return context, msg, nil
+		})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := logger.WithContext(logger.Context())
+			msg := strings.Repeat("x", i+1)
+			for j := 0; j < lines; j++ {
+				child.Println(msg)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(got) != goroutines*lines {
+		t.Fatalf("want %d lines, got: %d", goroutines*lines, len(got))
+	}
+	for _, line := range got {
+		var n int
+		var msg string
+		if _, err := fmt.Sscanf(line, "%d %s", &n, &msg); err != nil || n != len(msg) {
+			t.Fatalf("mixed entry: %q", line)
+		}
+	}
+
+	// the hooks update copies
+	if n := *logger.Context().(copierContext).N; n != 0 {
+		t.Fatalf("context updated: %d", n)
+	}
+}
+
+// sharedContext is not copied by CopyContext, its entries being
+// serialized from the hooks
+type sharedContext struct {
+	N *int
+}
+
+func BenchmarkLogger_parallel(b *testing.B) {
+	counter := func(v interface{}) *int {
+		switch context := v.(type) {
+		case copierContext:
+			return context.N
+		case sharedContext:
+			return context.N
+		}
+		return nil
+	}
+
+	contexts := []struct {
+		name       string
+		newContext func() interface{}
+	}{
+		{"copied", func() interface{} { return copierContext{N: new(int)} }},
+		{"shared", func() interface{} { return sharedContext{N: new(int)} }},
+	}
+
+	for _, context := range contexts {
+		newContext := context.newContext
+		logger := New(io.Discard).
+			WithContext(newContext()).
+			WithFormatter(func(v interface{}, msg string) (string, error) {
+				out, err := json.Marshal(benchmarkContext{
+					Time:    time.Now(),
+					Level:   strconv.Itoa(*counter(v)),
+					Message: msg,
+				})
+				return string(out), err
+			}).
+			AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+				*counter(v) = len(msg)
+				return v, msg, nil
+			})
+
+		for _, goroutines := range []int{1, 4, 16, 64} {
+			b.Run(fmt.Sprintf("%s/goroutines=%d", context.name, goroutines), func(b *testing.B) {
+				b.ReportAllocs()
+				wg := sync.WaitGroup{}
+				for i := 0; i < goroutines; i++ {
+					n := b.N / goroutines
+					if i < b.N%goroutines {
+						n++
+					}
+
+					wg.Add(1)
+					go func(child *Logger, n int) {
+						defer wg.Done()
+						for j := 0; j < n; j++ {
+							child.Println(j)
+						}
+					}(logger.WithContext(newContext()), n)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// lifecycleWriter records the calls of the lifecycle methods
+type lifecycleWriter struct {
+	name  string
+	calls *[]string
+	delay time.Duration
+	err   error
+}
+
+func (w lifecycleWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w lifecycleWriter) Flush() error {
+	time.Sleep(w.delay)
+	*w.calls = append(*w.calls, w.name+" flush")
+	return nil
+}
+
+func (w lifecycleWriter) Sync() error {
+	*w.calls = append(*w.calls, w.name+" sync")
+	return nil
+}
+
+func (w lifecycleWriter) Close() error {
+	*w.calls = append(*w.calls, w.name+" close")
+	return w.err
+}
+
+// queueWriter queues the entries to send on Flush,
+// and waits for them to be sent on Sync
+type queueWriter struct {
+	calls *[]string
+}
+
+func (w queueWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w queueWriter) Flush() {
+	*w.calls = append(*w.calls, "queue flush")
+}
+
+func (w queueWriter) Sync() error {
+	*w.calls = append(*w.calls, "queue sync")
+	return nil
+}
+
+func TestLogger_lifecycle(t *testing.T) {
+	var calls []string
+	a := New(lifecycleWriter{name: "a", calls: &calls})
+	b := New(queueWriter{calls: &calls})
+	tee := Tee(a, Route(func() *Logger { return b }), New(os.Stdout))
+
+	testSuite := map[string]struct {
+		fn   func() error
+		want []string
+	}{
+		"sync":        {tee.Sync, []string{"a flush", "a sync", "queue sync"}},
+		"close":       {tee.Close, []string{"a flush", "a sync", "a close", "queue sync"}},
+		"close clone": {a.WithContext("ctx").Close, []string{"a flush", "a sync", "a close"}},
+	}
+
+	for name, test := range testSuite {
+		calls = nil
+		if err := test.fn(); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if fmt.Sprint(calls) != fmt.Sprint(test.want) {
+			t.Fatalf("%s: want: %q, got: %q", name, test.want, calls)
+		}
+	}
+}
+
+func TestLogger_Close_file(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the branches share the file
+	logger := New(f)
+	tee := Tee(logger, logger.WithContext("ctx"))
+	tee.Println("message")
+
+	if err := tee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("want the file closed, got: %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var calls []string
+	Register(New(lifecycleWriter{name: "a", calls: &calls}))
+	Register(New(lifecycleWriter{name: "b", calls: &calls}))
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a flush", "a sync", "a close", "b flush", "b sync", "b close"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("want: %q, got: %q", want, calls)
+	}
+
+	// the registry is empty
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("closed twice: %q", calls)
+	}
+}
+
+func TestShutdown_deadline(t *testing.T) {
+	var calls []string
+	errClose := errors.New("close")
+	Register(New(lifecycleWriter{name: "slow", calls: &calls, delay: 100 * time.Millisecond, err: errClose}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	// the next call waits for the closing going on
+	// and returns its error
+	if err := Shutdown(context.Background()); !errors.Is(err, errClose) {
+		t.Fatalf("want: %v, got: %v", errClose, err)
+	}
+	want := []string{"slow flush", "slow sync", "slow close"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("want: %q, got: %q", want, calls)
+	}
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// blockingSyncWriter blocks in Sync until released
+type blockingSyncWriter struct {
+	syncing chan struct{}
+	release chan struct{}
+}
+
+func (w blockingSyncWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w blockingSyncWriter) Sync() error {
+	close(w.syncing)
+	<-w.release
+	return nil
+}
+
+func TestLogger_Sync_unlocked(t *testing.T) {
+	w := blockingSyncWriter{
+		syncing: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	logger := New(w)
+
+	synced := make(chan error)
+	go func() { synced <- logger.Sync() }()
+	<-w.syncing
+
+	// the clones write while the writer syncs
+	written := make(chan struct{})
+	go func() {
+		logger.WithContext("ctx").Println("message")
+		close(written)
+	}()
+
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write blocked by sync")
+	}
+
+	close(w.release)
+	if err := <-synced; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,281 @@
+// Package logtest captures log entries in tests and asserts on them.
+//
+// Recorder is an observer recording the context, message, level and
+// time of each entry written, as given to the formatter, so that
+// tests don't compare formatted strings:
+//
+//	rec := logtest.NewRecorder()
+//	logger := level.NewLevelLogger(io.Discard).
+//		WithContext(context).
+//		AddObserver(rec.Observe)
+//
+//	code(logger)
+//
+//	logtest.AssertMessage(t, rec.Entries().Level(level.ERROR), "connection refused")
+//
+// NewWriter returns a writer sending the formatted output to the test
+// log, shown by go test -v. The lines are reported at the Write
+// method of the writer, not at the logging call of the test.
+package logtest
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	libtime "time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/time"
+	"github.com/6prod/genelog/format/json"
+)
+
+// Entry is a recorded log entry
+type Entry struct {
+	// Context is the context given to the formatter
+	Context interface{}
+	Message string
+	// Output is the formatted entry, empty for the entries
+	// recorded by Hook
+	Output string
+	// Level is the level of the context if implementing
+	// level.Leveler, level.UNSET otherwise
+	Level level.Level
+	// Time is the time of the context if implementing
+	// time.Timer, the time of the recording otherwise
+	Time libtime.Time
+	// Fields are the top level fields of the JSON encoded context
+	// at the recording, nil if it couldn't be encoded
+	Fields map[string]string
+}
+
+// Field returns the value of a top level field of the JSON
+// encoded context, non string values being JSON encoded.
+//
+// The fields recorded by the Recorder are used, the context
+// being encoded for the entries without them.
+func (e Entry) Field(key string) (string, bool) {
+	fields := e.Fields
+	if fields == nil {
+		var err error
+		if fields, err = json.Fields(e.Context); err != nil {
+			return "", false
+		}
+	}
+	v, ok := fields[key]
+	return v, ok
+}
+
+// Entries is a list of entries
+type Entries []Entry
+
+// Filter returns the entries for which keep returns true
+func (e Entries) Filter(keep func(Entry) bool) Entries {
+	entries := make(Entries, 0)
+	for _, entry := range e {
+		if keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Level returns the entries at level l
+func (e Entries) Level(l level.Level) Entries {
+	return e.Filter(func(entry Entry) bool {
+		return entry.Level == l
+	})
+}
+
+// MinLevel returns the entries at level l or above
+func (e Entries) MinLevel(l level.Level) Entries {
+	return e.Filter(func(entry Entry) bool {
+		return level.IsActive(l, entry.Level)
+	})
+}
+
+// Message returns the entries with a message matching the
+// regular expression pattern. It panics if pattern is invalid.
+func (e Entries) Message(pattern string) Entries {
+	re := regexp.MustCompile(pattern)
+	return e.Filter(func(entry Entry) bool {
+		return re.MatchString(entry.Message)
+	})
+}
+
+// Field returns the entries with a context field key equal to
+// value, compared to the fmt.Sprint representation of value
+func (e Entries) Field(key string, value interface{}) Entries {
+	want := fmt.Sprint(value)
+	return e.Filter(func(entry Entry) bool {
+		v, ok := entry.Field(key)
+		return ok && v == want
+	})
+}
+
+// Messages returns the messages of the entries
+func (e Entries) Messages() []string {
+	messages := make([]string, 0, len(e))
+	for _, entry := range e {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+// Recorder records entries
+type Recorder struct {
+	mu      sync.Mutex
+	entries Entries
+	now     func() libtime.Time
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		entries: make(Entries, 0),
+		now:     libtime.Now,
+	}
+}
+
+// Observe records the entries written by the logger, after its
+// hooks and formatter. It is an observer for AddObserver.
+//
+// The entries skipped or failed before the writer are not recorded.
+func (r *Recorder) Observe(result genelog.Result) {
+	if result.Stage != genelog.StageWrite {
+		return
+	}
+	r.record(result.Context, result.Message, result.Output)
+}
+
+// Hook records the entry and returns it unchanged.
+//
+// The entry is recorded as it is when the hook runs: the hooks
+// added after it, like a hook skipping entries or setting the time,
+// are not seen. Add it last, or use Observe to record the entries
+// as the formatter sees them.
+func (r *Recorder) Hook(v interface{}, msg string) (interface{}, string, error) {
+	r.record(v, msg, "")
+	return v, msg, nil
+}
+
+// record records an entry. The context is recorded as is: pointers
+// it holds may change after the recording, the level, time and
+// fields are copied.
+func (r *Recorder) record(v interface{}, msg, output string) {
+	entry := Entry{
+		Context: v,
+		Message: msg,
+		Output:  output,
+		Time:    r.now(),
+	}
+	if fields, err := json.Fields(v); err == nil {
+		entry.Fields = fields
+	}
+	if leveler, ok := level.GetLeveler(v); ok {
+		entry.Level = leveler.Level()
+	}
+	if timer, ok := v.(time.Timer); ok {
+		entry.Time = timer.Time()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// Logger returns a logger recording its entries
+// and discarding the output
+func (r *Recorder) Logger() *genelog.Logger {
+	return genelog.New(io.Discard).AddObserver(r.Observe)
+}
+
+// Entries returns a copy of the recorded entries
+func (r *Recorder) Entries() Entries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(make(Entries, 0, len(r.entries)), r.entries...)
+}
+
+// Reset removes the recorded entries
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = make(Entries, 0)
+}
+
+// AssertCount fails the test if there are not n entries
+func AssertCount(t testing.TB, entries Entries, n int) {
+	t.Helper()
+	if len(entries) != n {
+		t.Fatalf("want %d entries, got %d: %q", n, len(entries), entries.Messages())
+	}
+}
+
+// AssertEmpty fails the test if there are entries
+func AssertEmpty(t testing.TB, entries Entries) {
+	t.Helper()
+	AssertCount(t, entries, 0)
+}
+
+// AssertMessage fails the test if no message matches pattern
+func AssertMessage(t testing.TB, entries Entries, pattern string) {
+	t.Helper()
+	if len(entries.Message(pattern)) == 0 {
+		t.Fatalf("no message matching %q in %q", pattern, entries.Messages())
+	}
+}
+
+// AssertLevel fails the test if no entry is at level l
+func AssertLevel(t testing.TB, entries Entries, l level.Level) {
+	t.Helper()
+	if len(entries.Level(l)) == 0 {
+		t.Fatalf("no %s entry in %q", l, entries.Messages())
+	}
+}
+
+// AssertField fails the test if no entry has the field key equal to value
+func AssertField(t testing.TB, entries Entries, key string, value interface{}) {
+	t.Helper()
+	if len(entries.Field(key, value)) == 0 {
+		t.Fatalf("no entry with %s=%v in %q", key, value, entries.Messages())
+	}
+}
+
+// Writer writes to the log of a test
+type Writer struct {
+	mu   sync.Mutex
+	t    testing.TB
+	done bool
+}
+
+// NewWriter returns a writer logging each line with t.Log.
+//
+// Writes after the end of the test are dropped instead
+// of panicking.
+func NewWriter(t testing.TB) *Writer {
+	w := &Writer{t: t}
+	t.Cleanup(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.done = true
+	})
+	return w
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.done {
+		return len(p), nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		w.t.Log(line)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,208 @@
+package logtest
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	libtime "time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/time"
+	"github.com/6prod/genelog/format/json"
+)
+
+type exampleContext struct {
+	*level.WithLevel
+	*time.WithTime
+	User string `json:"user"`
+}
+
+func newContext(user string) exampleContext {
+	return exampleContext{
+		WithLevel: level.NewWithLevel(level.DEBUG),
+		WithTime:  time.NewWithTime(libtime.Time{}),
+		User:      user,
+	}
+}
+
+func ExampleRecorder() {
+	rec := NewRecorder()
+
+	logger := level.NewLevelLogger(io.Discard).
+		WithContext(newContext("bob")).
+		AddHook(time.HookUpdateTime).
+		AddObserver(rec.Observe)
+
+	logger.Info("started")
+	logger.Errorf("connection %s", "refused")
+
+	for _, entry := range rec.Entries() {
+		fmt.Println(entry.Level, entry.Message, entry.Time.IsZero())
+	}
+
+	// Output:
+	// info started false
+	// error connection refused false
+}
+
+func TestEntries(t *testing.T) {
+	rec := NewRecorder()
+
+	logger := level.LevelLogger{Logger: rec.Logger()}.
+		AddHook(level.HookLevelSkip).
+		WithContext(newContext("alice"))
+
+	logger.Debug("debug message")
+	logger.WithContext(newContext("bob")).Warning("disk almost full")
+	logger.Error("disk full")
+
+	entries := rec.Entries()
+
+	AssertCount(t, entries, 3)
+	AssertCount(t, entries.MinLevel(level.WARNING), 2)
+	AssertLevel(t, entries, level.DEBUG)
+	AssertMessage(t, entries.Level(level.ERROR), "^disk")
+	AssertField(t, entries.Level(level.WARNING), "user", "bob")
+	AssertEmpty(t, entries.Field("user", "carol"))
+
+	rec.Reset()
+	AssertEmpty(t, rec.Entries())
+}
+
+func TestEntry_Field(t *testing.T) {
+	entry := Entry{Context: map[string]interface{}{"n": 1, "s": "a"}}
+
+	if v, ok := entry.Field("n"); !ok || v != "1" {
+		t.Fatalf("want 1, got: %s", v)
+	}
+	if _, ok := entry.Field("missing"); ok {
+		t.Fatal("want missing field")
+	}
+
+	entries := Entries{entry}
+	if got := entries.Field("n", 1); len(got) != 1 {
+		t.Fatalf("want 1 entry, got: %d", len(got))
+	}
+}
+
+func TestRecorder_Hook_fields(t *testing.T) {
+	rec := NewRecorder()
+
+	user := "alice"
+	logger := rec.Logger().WithContext(struct {
+		User *string `json:"user"`
+	}{&user})
+
+	logger.Println("first")
+	user = "bob"
+	logger.Println("second")
+
+	entries := rec.Entries()
+	AssertCount(t, entries.Field("user", "alice"), 1)
+	AssertMessage(t, entries.Field("user", "alice"), "^first")
+	AssertMessage(t, entries.Field("user", "bob"), "^second")
+}
+
+func TestRecorder_Observe(t *testing.T) {
+	rec := NewRecorder()
+
+	logger := level.LevelLogger{Logger: genelog.New(io.Discard).
+		WithContext(newContext("alice")).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return "formatted " + msg, nil
+		}).
+		AddObserver(rec.Observe)}
+
+	// the hooks added after the observer are seen
+	logger = logger.
+		AddHook(level.NewHookLevelMin(level.INFO)).
+		AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+			return v, "[app] " + msg, nil
+		})
+
+	logger.Debug("skipped")
+	logger.Error("disk full")
+
+	entries := rec.Entries()
+	AssertCount(t, entries, 1)
+	AssertMessage(t, entries.Level(level.ERROR), `^\[app\] disk full$`)
+	if want, got := "formatted [app] disk full", entries[0].Output; want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+// fakeTB records the failures of assertions
+type fakeTB struct {
+	testing.TB
+	failed bool
+	logs   []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failed = true
+}
+
+func (f *fakeTB) Log(args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprint(args...))
+}
+
+func TestAssert_fail(t *testing.T) {
+	entries := Entries{{Message: "a", Level: level.INFO}}
+
+	for name, assert := range map[string]func(testing.TB){
+		"count":   func(tb testing.TB) { AssertCount(tb, entries, 2) },
+		"empty":   func(tb testing.TB) { AssertEmpty(tb, entries) },
+		"message": func(tb testing.TB) { AssertMessage(tb, entries, "b") },
+		"level":   func(tb testing.TB) { AssertLevel(tb, entries, level.ERROR) },
+		"field":   func(tb testing.TB) { AssertField(tb, entries, "user", "bob") },
+	} {
+		tb := &fakeTB{}
+		assert(tb)
+		if !tb.failed {
+			t.Fatalf("%s: want failure", name)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tb := &fakeTB{}
+	w := &Writer{t: tb}
+
+	logger := genelog.New(w).
+		WithContext(map[string]string{"user": "bob"}).
+		WithFormatter(json.JSON)
+
+	logger.Println("mylog")
+	_, _ = io.WriteString(w, "line1\nline2\n")
+
+	want := []string{
+		`{"context":{"user":"bob"},"message":"mylog"}`,
+		"line1",
+		"line2",
+	}
+	if len(tb.logs) != len(want) {
+		t.Fatalf("want: %q, got: %q", want, tb.logs)
+	}
+	for i := range want {
+		if tb.logs[i] != want[i] {
+			t.Fatalf("want: %s, got: %s", want[i], tb.logs[i])
+		}
+	}
+
+	// writes after the test are dropped
+	w.done = true
+	_, _ = io.WriteString(w, "late")
+	if len(tb.logs) != len(want) {
+		t.Fatalf("%q: late write should be dropped", tb.logs)
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	w := NewWriter(t)
+	if _, err := io.WriteString(w, "shown with go test -v\n"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package metrics counts the entries of loggers, and exposes the
+// counters with expvar and in the Prometheus text format.
+//
+// Metrics is wired to loggers as an observer. The entries are
+// counted by the loggers writing them: with Tee, add the observer
+// to the branches, and to the Tee to count the entries its hooks
+// skip.
+//
+//	m := metrics.New()
+//	m.Publish("genelog")
+//	http.Handle("/metrics", m)
+//
+//	logger := level.NewLevelLogger(os.Stdout).
+//		WithFormatter(json.JSON).
+//		AddObserver(m.Observer)
+package metrics
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	libhttp "net/http"
+	"sync/atomic"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// levels are the levels of the counters, the entries without
+// Leveler context or with an unknown level being counted as UNSET
+var levels = []level.Level{
+	level.UNSET,
+	level.DEBUG,
+	level.INFO,
+	level.WARNING,
+	level.ERROR,
+	level.FATAL,
+}
+
+// stages are the stages of the error counters
+var stages = []genelog.Stage{
+	genelog.StageHook,
+	genelog.StageFormat,
+	genelog.StageWrite,
+}
+
+// Metrics counts entries. It is safe for concurrent use.
+type Metrics struct {
+	// the counters are first to be 64-bit aligned for atomic operations
+	entries [level.FATAL + 1]uint64
+	skipped [level.FATAL + 1]uint64
+	errors  [genelog.StageWrite + 1]uint64
+	bytes   uint64
+
+	namespace string
+}
+
+// Snapshot is a copy of the counters
+type Snapshot struct {
+	// Entries is the number of entries written by level
+	Entries map[string]uint64 `json:"entries"`
+	// Skipped is the number of entries skipped by hooks by level
+	Skipped map[string]uint64 `json:"skipped"`
+	// Errors is the number of failed entries by stage
+	Errors map[string]uint64 `json:"errors"`
+	// Bytes is the number of bytes written
+	Bytes uint64 `json:"bytes"`
+}
+
+// New returns metrics exposed with the genelog namespace
+func New() *Metrics {
+	return &Metrics{
+		namespace: "genelog",
+	}
+}
+
+// WithNamespace changes the prefix of the Prometheus metric names
+func (m *Metrics) WithNamespace(namespace string) *Metrics {
+	m.namespace = namespace
+	return m
+}
+
+// Observer counts the result of an entry.
+// It is passed to genelog.Logger.AddObserver.
+func (m *Metrics) Observer(r genelog.Result) {
+	if r.Stage == genelog.StageWrite {
+		atomic.AddUint64(&m.bytes, uint64(r.N))
+	}
+
+	switch {
+	case r.Err == nil:
+		atomic.AddUint64(&m.entries[levelOf(r.Context)], 1)
+	case errors.Is(r.Err, genelog.ErrSkip):
+		atomic.AddUint64(&m.skipped[levelOf(r.Context)], 1)
+	case r.Stage >= 0 && int(r.Stage) < len(m.errors):
+		atomic.AddUint64(&m.errors[r.Stage], 1)
+	}
+}
+
+// levelOf returns the level of the context
+func levelOf(context interface{}) level.Level {
+	leveler, ok := level.GetLeveler(context)
+	if !ok {
+		return level.UNSET
+	}
+	l := leveler.Level()
+	if l < level.UNSET || l > level.FATAL {
+		return level.UNSET
+	}
+	return l
+}
+
+// Snapshot returns a copy of the counters
+func (m *Metrics) Snapshot() Snapshot {
+	s := Snapshot{
+		Entries: make(map[string]uint64, len(levels)),
+		Skipped: make(map[string]uint64, len(levels)),
+		Errors:  make(map[string]uint64, len(stages)),
+		Bytes:   atomic.LoadUint64(&m.bytes),
+	}
+	for _, l := range levels {
+		s.Entries[l.String()] = atomic.LoadUint64(&m.entries[l])
+		s.Skipped[l.String()] = atomic.LoadUint64(&m.skipped[l])
+	}
+	for _, stage := range stages {
+		s.Errors[stage.String()] = atomic.LoadUint64(&m.errors[stage])
+	}
+	return s
+}
+
+// Publish exposes the snapshot with expvar under name.
+// Like expvar.Publish, it panics if name is already used.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+// WriteTo writes the counters in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+
+	name := m.namespace + "_entries_total"
+	fmt.Fprintf(cw, "# HELP %s Entries written by level.\n# TYPE %s counter\n", name, name)
+	for _, l := range levels {
+		fmt.Fprintf(cw, "%s{level=%q} %d\n", name, l.String(), atomic.LoadUint64(&m.entries[l]))
+	}
+
+	name = m.namespace + "_skipped_total"
+	fmt.Fprintf(cw, "# HELP %s Entries skipped by hooks by level.\n# TYPE %s counter\n", name, name)
+	for _, l := range levels {
+		fmt.Fprintf(cw, "%s{level=%q} %d\n", name, l.String(), atomic.LoadUint64(&m.skipped[l]))
+	}
+
+	name = m.namespace + "_errors_total"
+	fmt.Fprintf(cw, "# HELP %s Entries failed by stage.\n# TYPE %s counter\n", name, name)
+	for _, stage := range stages {
+		fmt.Fprintf(cw, "%s{stage=%q} %d\n", name, stage.String(), atomic.LoadUint64(&m.errors[stage]))
+	}
+
+	name = m.namespace + "_written_bytes_total"
+	fmt.Fprintf(cw, "# HELP %s Bytes written.\n# TYPE %s counter\n", name, name)
+	fmt.Fprintf(cw, "%s %d\n", name, atomic.LoadUint64(&m.bytes))
+
+	return cw.n, cw.err
+}
+
+// ServeHTTP writes the counters in the Prometheus text format
+func (m *Metrics) ServeHTTP(w libhttp.ResponseWriter, req *libhttp.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// countWriter counts the bytes written and keeps the first error
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
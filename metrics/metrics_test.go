@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+type exampleWithLevel struct {
+	*level.WithLevel
+}
+
+func ExampleMetrics_WriteTo() {
+	m := New().WithNamespace("app")
+
+	logger := level.LevelLogger{Logger: genelog.New(io.Discard)}.
+		AddHook(level.HookLevelSkip).
+		AddObserver(m.Observer).
+		WithContext(exampleWithLevel{level.NewWithLevel(level.INFO)})
+
+	logger.Infoln("started")
+	logger.Errorln("failed")
+	logger.Writer(level.DEBUG).Write([]byte("not written\n"))
+
+	_, _ = m.WriteTo(os.Stdout)
+
+	// Output:
+	// # HELP app_entries_total Entries written by level.
+	// # TYPE app_entries_total counter
+	// app_entries_total{level="unset"} 0
+	// app_entries_total{level="debug"} 0
+	// app_entries_total{level="info"} 1
+	// app_entries_total{level="warning"} 0
+	// app_entries_total{level="error"} 1
+	// app_entries_total{level="fatal"} 0
+	// # HELP app_skipped_total Entries skipped by hooks by level.
+	// # TYPE app_skipped_total counter
+	// app_skipped_total{level="unset"} 0
+	// app_skipped_total{level="debug"} 0
+	// app_skipped_total{level="info"} 0
+	// app_skipped_total{level="warning"} 0
+	// app_skipped_total{level="error"} 0
+	// app_skipped_total{level="fatal"} 0
+	// # HELP app_errors_total Entries failed by stage.
+	// # TYPE app_errors_total counter
+	// app_errors_total{stage="hook"} 0
+	// app_errors_total{stage="format"} 0
+	// app_errors_total{stage="write"} 0
+	// # HELP app_written_bytes_total Bytes written.
+	// # TYPE app_written_bytes_total counter
+	// app_written_bytes_total 15
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestMetrics_Observer(t *testing.T) {
+	m := New()
+
+	skipDebug := func(v interface{}, msg string) (interface{}, string, error) {
+		if v.(exampleWithLevel).Level() == level.DEBUG {
+			return v, msg, genelog.ErrSkip
+		}
+		return v, msg, nil
+	}
+	failHook := func(v interface{}, msg string) (interface{}, string, error) {
+		if msg == "bad hook" {
+			return v, msg, errors.New("hook failed")
+		}
+		return v, msg, nil
+	}
+	failFormat := func(v interface{}, msg string) (string, error) {
+		if msg == "bad format" {
+			return "", errors.New("format failed")
+		}
+		return msg, nil
+	}
+
+	context := exampleWithLevel{level.NewWithLevel(level.DEBUG)}
+	logger := level.LevelLogger{Logger: genelog.Tee(
+		genelog.New(io.Discard).
+			WithFormatter(failFormat).
+			AddHook(failHook).
+			AddObserver(m.Observer),
+		genelog.New(failingWriter{}).
+			AddHook(level.NewHookLevelMin(level.ERROR)).
+			AddObserver(m.Observer),
+	)}.
+		AddHook(skipDebug).
+		AddObserver(m.Observer).
+		WithContext(context)
+
+	logger.Debugln("skipped")
+	logger.Infoln("hello")
+	logger.Warningln("bad hook")
+	logger.Infoln("bad format")
+	logger.Errorln("boom")
+
+	want := Snapshot{
+		Entries: map[string]uint64{"info": 1, "error": 1},
+		Skipped: map[string]uint64{"debug": 1, "info": 2, "warning": 1},
+		Errors:  map[string]uint64{"hook": 1, "format": 1, "write": 1},
+		Bytes:   uint64(len("hello\n") + len("boom\n")),
+	}
+	got := m.Snapshot()
+
+	for _, l := range levels {
+		name := l.String()
+		if got.Entries[name] != want.Entries[name] {
+			t.Fatalf("entries %s: want: %d, got: %d", name, want.Entries[name], got.Entries[name])
+		}
+		if got.Skipped[name] != want.Skipped[name] {
+			t.Fatalf("skipped %s: want: %d, got: %d", name, want.Skipped[name], got.Skipped[name])
+		}
+	}
+	for _, stage := range stages {
+		name := stage.String()
+		if got.Errors[name] != want.Errors[name] {
+			t.Fatalf("errors %s: want: %d, got: %d", name, want.Errors[name], got.Errors[name])
+		}
+	}
+	if got.Bytes != want.Bytes {
+		t.Fatalf("bytes: want: %d, got: %d", want.Bytes, got.Bytes)
+	}
+}
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := New()
+	m.Observer(genelog.Result{Stage: genelog.StageWrite, N: 3})
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("content type: %s", got)
+	}
+	for _, want := range []string{
+		`genelog_entries_total{level="unset"} 1`,
+		"genelog_written_bytes_total 3",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("want %q in:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+func TestMetrics_Publish(t *testing.T) {
+	m := New()
+	m.Publish("genelog_test")
+	m.Observer(genelog.Result{Stage: genelog.StageFormat, Err: errors.New("bad")})
+
+	v := expvar.Get("genelog_test")
+	if v == nil {
+		t.Fatal("not published")
+	}
+	if want := `"format":1`; !strings.Contains(v.String(), want) {
+		t.Fatalf("want %s in %s", want, v.String())
+	}
+}
@@ -0,0 +1,22 @@
+module github.com/6prod/genelog/middleware/grpc
+
+go 1.19
+
+require (
+	github.com/6prod/genelog v0.0.0
+	google.golang.org/grpc v1.57.2
+	google.golang.org/protobuf v1.30.0
+)
+
+require (
+	github.com/fatih/color v1.13.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/mattn/go-colorable v0.1.9 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
+)
+
+replace github.com/6prod/genelog => ../..
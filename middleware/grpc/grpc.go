@@ -0,0 +1,502 @@
+// Package grpc provides gRPC interceptors logging calls.
+//
+// Server and client interceptors, unary and streaming, log each
+// call once completed, with its method, kind, peer, status code,
+// duration and message counts in the Call field of the context.
+// The level depends on the code, see CodeLevel.
+//
+// Payloads can be logged, capped in size and redacted, with
+// WithPayload. Unary payloads are set in the Call field of the
+// completion entry; stream messages are logged one by one at
+// the DEBUG level.
+//
+// Server handlers get a call-scoped logger, carrying the call
+// field, with FromContext.
+//
+// The package is a module of its own, requiring Go 1.19 like
+// google.golang.org/grpc, so that genelog keeps supporting Go 1.17.
+//
+// Example:
+//
+//	type Context struct {
+//		*level.WithLevel
+//		*grpc.WithCall
+//	}
+//
+//	newContext := func() interface{} {
+//		return Context{level.NewWithLevel(level.INFO), grpc.NewWithCall()}
+//	}
+//
+//	interceptor := grpc.New(logger, newContext)
+//
+//	server := libgrpc.NewServer(
+//		libgrpc.ChainUnaryInterceptor(interceptor.UnaryServerInterceptor()),
+//		libgrpc.ChainStreamInterceptor(interceptor.StreamServerInterceptor()),
+//	)
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	libtime "time"
+	"unicode/utf8"
+
+	libgrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/hook/redact"
+)
+
+// Side of a call
+const (
+	Server = "server"
+	Client = "client"
+)
+
+// Kind of a call
+const (
+	Unary        = "unary"
+	ClientStream = "client_stream"
+	ServerStream = "server_stream"
+	BidiStream   = "bidi_stream"
+)
+
+// Call describes a gRPC call and its outcome
+type Call struct {
+	Method   string           `json:"method"`
+	Side     string           `json:"side"`
+	Kind     string           `json:"kind"`
+	Peer     string           `json:"peer,omitempty"`
+	Code     string           `json:"code,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Start    libtime.Time     `json:"start"`
+	Duration libtime.Duration `json:"duration,omitempty"`
+	Sent     int              `json:"sent,omitempty"`
+	Received int              `json:"received,omitempty"`
+	Request  string           `json:"request,omitempty"`
+	Response string           `json:"response,omitempty"`
+}
+
+type WithCall struct {
+	call Call
+}
+
+func NewWithCall() *WithCall {
+	return &WithCall{}
+}
+
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithCall) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
+func (w WithCall) Call() Call {
+	return w.call
+}
+
+func (w *WithCall) CallSet(c Call) {
+	w.call = c
+}
+
+func (w WithCall) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Call Call `json:"call"`
+	}{
+		Call: w.call,
+	})
+}
+
+// Caller is the interface to access the call field
+type Caller interface {
+	Call() Call
+	CallSet(Call)
+}
+
+// CodeLevel returns the level of a status code.
+//
+// Like the HTTP status classes, errors caused by the client
+// are WARNING and errors of the server are ERROR. A canceled
+// call is INFO: the client went away.
+func CodeLevel(code codes.Code) level.Level {
+	switch code {
+	case codes.OK, codes.Canceled:
+		return level.INFO
+	case codes.InvalidArgument,
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.PermissionDenied,
+		codes.Unauthenticated,
+		codes.ResourceExhausted,
+		codes.FailedPrecondition,
+		codes.Aborted,
+		codes.OutOfRange:
+		return level.WARNING
+	}
+	return level.ERROR
+}
+
+// StreamKind returns the kind of a stream
+func StreamKind(clientStreams, serverStreams bool) string {
+	switch {
+	case clientStreams && serverStreams:
+		return BidiStream
+	case clientStreams:
+		return ClientStream
+	case serverStreams:
+		return ServerStream
+	}
+	return Unary
+}
+
+// contextKey is the key of the logger in the call context
+type contextKey struct{}
+
+// FromContext returns the call-scoped logger
+func FromContext(ctx context.Context) (level.LevelLogger, bool) {
+	logger, ok := ctx.Value(contextKey{}).(level.LevelLogger)
+	return logger, ok
+}
+
+// Interceptor logs the calls of servers and clients
+type Interceptor struct {
+	logger   level.LevelLogger
+	context  func() interface{}
+	payload  int
+	redactor *redact.Redactor
+	now      func() libtime.Time
+}
+
+// New returns an interceptor logging to logger.
+//
+// newContext returns a new context for each call, so that
+// concurrent calls don't share the fields. It must implement
+// Caller, and level.Leveler to log the level.
+func New(logger level.LevelLogger, newContext func() interface{}) *Interceptor {
+	return &Interceptor{
+		logger:  logger,
+		context: newContext,
+		now:     libtime.Now,
+	}
+}
+
+// WithPayload logs the messages as JSON, truncated to max bytes.
+//
+// If redactor isn't nil, it masks the messages before they are
+// truncated, with its deny list applying to the message fields.
+func (i *Interceptor) WithPayload(max int, redactor *redact.Redactor) *Interceptor {
+	interceptor := *i
+	interceptor.payload = max
+	interceptor.redactor = redactor
+	return &interceptor
+}
+
+// UnaryServerInterceptor returns the interceptor of unary server calls
+func (i *Interceptor) UnaryServerInterceptor() libgrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *libgrpc.UnaryServerInfo, handler libgrpc.UnaryHandler) (interface{}, error) {
+		c := i.start(info.FullMethod, Server, Unary, peerAddr(ctx))
+		c.call.Request = i.render(req)
+
+		resp, err := handler(contextWithLogger(ctx, c.logger), req)
+
+		if err == nil {
+			c.call.Response = i.render(resp)
+		}
+		c.done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns the interceptor of stream server calls
+func (i *Interceptor) StreamServerInterceptor() libgrpc.StreamServerInterceptor {
+	return func(srv interface{}, ss libgrpc.ServerStream, info *libgrpc.StreamServerInfo, handler libgrpc.StreamHandler) error {
+		ctx := ss.Context()
+		kind := StreamKind(info.IsClientStream, info.IsServerStream)
+		c := i.start(info.FullMethod, Server, kind, peerAddr(ctx))
+
+		err := handler(srv, &serverStream{
+			ServerStream: ss,
+			ctx:          contextWithLogger(ctx, c.logger),
+			call:         c,
+		})
+
+		c.done(err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns the interceptor of unary client calls
+func (i *Interceptor) UnaryClientInterceptor() libgrpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *libgrpc.ClientConn, invoker libgrpc.UnaryInvoker, opts ...libgrpc.CallOption) error {
+		c := i.start(method, Client, Unary, cc.Target())
+		c.call.Request = i.render(req)
+
+		p := peer.Peer{}
+		err := invoker(ctx, method, req, reply, cc, append(opts, libgrpc.Peer(&p))...)
+
+		if p.Addr != nil {
+			c.call.Peer = p.Addr.String()
+		}
+		if err == nil {
+			c.call.Response = i.render(reply)
+		}
+		c.done(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns the interceptor of stream client calls.
+//
+// The call is logged when the stream ends: when RecvMsg returns
+// an error, io.EOF included, or the single response of a client
+// stream.
+func (i *Interceptor) StreamClientInterceptor() libgrpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *libgrpc.StreamDesc, cc *libgrpc.ClientConn, method string, streamer libgrpc.Streamer, opts ...libgrpc.CallOption) (libgrpc.ClientStream, error) {
+		kind := StreamKind(desc.ClientStreams, desc.ServerStreams)
+		c := i.start(method, Client, kind, cc.Target())
+
+		p := &peer.Peer{}
+		cs, err := streamer(ctx, desc, cc, method, append(opts, libgrpc.Peer(p))...)
+		if err != nil {
+			c.done(err)
+			return nil, err
+		}
+
+		return &clientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			peer:          p,
+			call:          c,
+		}, nil
+	}
+}
+
+// start returns the state of a new call
+func (i *Interceptor) start(method, side, kind, peer string) *call {
+	context := i.context()
+	caller, ok := context.(Caller)
+
+	c := &call{
+		interceptor: i,
+		caller:      caller,
+		logger:      i.logger.WithContext(context),
+		call: Call{
+			Method: method,
+			Side:   side,
+			Kind:   kind,
+			Peer:   peer,
+			Start:  i.now(),
+		},
+	}
+	if ok {
+		caller.CallSet(c.call)
+	}
+	return c
+}
+
+// render returns m as JSON, redacted and truncated,
+// or an empty string if payloads aren't logged
+func (i *Interceptor) render(m interface{}) string {
+	if i.payload <= 0 || m == nil {
+		return ""
+	}
+
+	var b []byte
+	var err error
+	if message, ok := m.(proto.Message); ok {
+		b, err = protojson.Marshal(message)
+	} else {
+		b, err = json.Marshal(m)
+	}
+	if err != nil {
+		return fmt.Sprintf("%T: %s", m, err)
+	}
+
+	// decode and encode again to mask the fields
+	// and normalize the protojson output
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err == nil {
+		if i.redactor != nil {
+			v, _, _ = i.redactor.Hook(v, "")
+		}
+		if normalized, err := json.Marshal(v); err == nil {
+			b = normalized
+		}
+	}
+
+	if len(b) <= i.payload {
+		return string(b)
+	}
+	n := i.payload
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return string(b[:n]) + "..."
+}
+
+// call is the state of a call being logged
+type call struct {
+	interceptor *Interceptor
+	caller      Caller
+	logger      level.LevelLogger
+
+	mu   sync.Mutex
+	call Call
+	once sync.Once
+}
+
+// message records a stream message and logs its payload
+func (c *call) message(m interface{}, sent bool) {
+	payload := c.interceptor.render(m)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	direction := "recv"
+	if sent {
+		c.call.Sent++
+		direction = "send"
+	} else {
+		c.call.Received++
+	}
+
+	if payload == "" || c.caller == nil {
+		return
+	}
+
+	call := c.call
+	call.Request, call.Response = "", ""
+	if (c.call.Side == Server) != sent {
+		call.Request = payload
+	} else {
+		call.Response = payload
+	}
+	c.caller.CallSet(call)
+	c.logger.Debugln(fmt.Sprintf("%s %s", c.call.Method, direction))
+}
+
+// done logs the completed call once
+func (c *call) done(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.caller == nil {
+			return
+		}
+
+		st := status.Convert(err)
+		c.call.Code = st.Code().String()
+		if err != nil {
+			c.call.Error = st.Message()
+		}
+		c.call.Duration = c.interceptor.now().Sub(c.call.Start)
+		c.caller.CallSet(c.call)
+
+		msg := fmt.Sprintf("%s %s", c.call.Method, c.call.Code)
+		switch CodeLevel(st.Code()) {
+		case level.ERROR:
+			c.logger.Errorln(msg)
+		case level.WARNING:
+			c.logger.Warningln(msg)
+		default:
+			c.logger.Infoln(msg)
+		}
+	})
+}
+
+// serverStream counts the messages of a server stream
+// and carries the call-scoped logger
+type serverStream struct {
+	libgrpc.ServerStream
+	ctx  context.Context
+	call *call
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.call.message(m, true)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.call.message(m, false)
+	}
+	return err
+}
+
+// clientStream counts the messages of a client stream
+// and logs the call when it ends
+type clientStream struct {
+	libgrpc.ClientStream
+	serverStreams bool
+	peer          *peer.Peer
+	call          *call
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.call.message(m, true)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	switch {
+	case errors.Is(err, io.EOF):
+		s.done(nil)
+	case err != nil:
+		s.done(err)
+	default:
+		s.call.message(m, false)
+		// a client stream ends with its single response
+		if !s.serverStreams {
+			s.done(nil)
+		}
+	}
+	return err
+}
+
+// done logs the call with the address of the server,
+// known once the stream is finished
+func (s *clientStream) done(err error) {
+	if s.peer.Addr != nil {
+		s.call.mu.Lock()
+		s.call.call.Peer = s.peer.Addr.String()
+		s.call.mu.Unlock()
+	}
+	s.call.done(err)
+}
+
+func contextWithLogger(ctx context.Context, logger level.LevelLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
@@ -0,0 +1,352 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	libtime "time"
+
+	libgrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/hook/redact"
+	"github.com/6prod/genelog/logtest"
+)
+
+type testContext struct {
+	*level.WithLevel
+	*WithCall
+}
+
+func newContext() interface{} {
+	return testContext{
+		level.NewWithLevel(level.DEBUG),
+		NewWithCall(),
+	}
+}
+
+func newTestInterceptor(logger level.LevelLogger) *Interceptor {
+	interceptor := New(logger, newContext)
+
+	now := libtime.Date(2022, 2, 1, 12, 30, 0, 0, libtime.UTC)
+	interceptor.now = func() libtime.Time {
+		now = now.Add(10 * libtime.Millisecond)
+		return now
+	}
+	return interceptor
+}
+
+// echo is a test service without generated code:
+// Echo returns its request, or an Internal error for "fail",
+// Struct returns its request, and Stream echoes each message.
+var echoDesc = libgrpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []libgrpc.MethodDesc{
+		{
+			MethodName: "Echo",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor libgrpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &wrapperspb.StringValue{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					if logger, ok := FromContext(ctx); ok {
+						logger.Debugln("echo")
+					}
+					in := req.(*wrapperspb.StringValue)
+					if in.Value == "fail" {
+						return nil, status.Error(codes.Internal, "boom")
+					}
+					return in, nil
+				}
+				info := &libgrpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Echo/Echo"}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+		{
+			MethodName: "Struct",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor libgrpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &structpb.Struct{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return req, nil
+				}
+				info := &libgrpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Echo/Struct"}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Streams: []libgrpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(srv interface{}, stream libgrpc.ServerStream) error {
+				if logger, ok := FromContext(stream.Context()); ok {
+					logger.Debugln("stream")
+				}
+				for {
+					in := &wrapperspb.StringValue{}
+					err := stream.RecvMsg(in)
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					if err != nil {
+						return err
+					}
+					if err := stream.SendMsg(in); err != nil {
+						return err
+					}
+				}
+			},
+		},
+	},
+}
+
+var streamDesc = &echoDesc.Streams[0]
+
+// dial serves the echo service through interceptors
+// and returns a client conn through interceptors
+func dial(t *testing.T, server, client *Interceptor) *libgrpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := libgrpc.NewServer(
+		libgrpc.ChainUnaryInterceptor(server.UnaryServerInterceptor()),
+		libgrpc.ChainStreamInterceptor(server.StreamServerInterceptor()),
+	)
+	s.RegisterService(&echoDesc, struct{}{})
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	cc, err := libgrpc.Dial("bufnet",
+		libgrpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		libgrpc.WithTransportCredentials(insecure.NewCredentials()),
+		libgrpc.WithChainUnaryInterceptor(client.UnaryClientInterceptor()),
+		libgrpc.WithChainStreamInterceptor(client.StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cc.Close() })
+	return cc
+}
+
+// newRecorder returns a logger recording the entries written, on
+// the copies of the context made for each entry
+func newRecorder() (*logtest.Recorder, level.LevelLogger) {
+	rec := logtest.NewRecorder()
+	logger := genelog.New(io.Discard).
+		AddObserver(rec.Observe)
+	return rec, level.LevelLogger{Logger: logger}.AddHook(level.HookLevelSkip)
+}
+
+func TestInterceptor_unary(t *testing.T) {
+	serverRec, serverLogger := newRecorder()
+	clientRec, clientLogger := newRecorder()
+	cc := dial(t, newTestInterceptor(serverLogger), newTestInterceptor(clientLogger))
+
+	ctx := context.Background()
+	out := &wrapperspb.StringValue{}
+	if err := cc.Invoke(ctx, "/test.Echo/Echo", wrapperspb.String("hello"), out); err != nil {
+		t.Fatal(err)
+	}
+	err := cc.Invoke(ctx, "/test.Echo/Echo", wrapperspb.String("fail"), out)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("want: Internal, got: %v", err)
+	}
+
+	server := serverRec.Entries()
+	logtest.AssertCount(t, server.Level(level.DEBUG), 2)
+	logtest.AssertMessage(t, server.Level(level.INFO), "^/test.Echo/Echo OK$")
+	logtest.AssertMessage(t, server.Level(level.ERROR), "^/test.Echo/Echo Internal$")
+
+	call := server.Level(level.ERROR)[0].Context.(testContext).Call()
+	if call.Side != Server || call.Kind != Unary || call.Error != "boom" ||
+		call.Peer == "" || call.Duration != 10*libtime.Millisecond {
+		t.Fatalf("%+v: missing call fields", call)
+	}
+	if call.Request != "" {
+		t.Fatalf("%s: payload logged without WithPayload", call.Request)
+	}
+
+	// the handler logs carry the call
+	debug := server.Level(level.DEBUG)[0].Context.(testContext).Call()
+	if debug.Method != "/test.Echo/Echo" || debug.Code != "" {
+		t.Fatalf("%+v: call not set in handler logger", debug)
+	}
+
+	client := clientRec.Entries()
+	logtest.AssertMessage(t, client.Level(level.INFO), "^/test.Echo/Echo OK$")
+	logtest.AssertMessage(t, client.Level(level.ERROR), "^/test.Echo/Echo Internal$")
+	if call := client.Level(level.INFO)[0].Context.(testContext).Call(); call.Side != Client || call.Peer != "bufconn" {
+		t.Fatalf("%+v: missing client call fields", call)
+	}
+}
+
+func TestInterceptor_lines(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger := level.LevelLogger{Logger: genelog.New(&buf).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			return msg, nil
+		})}.
+		AddHook(level.HookLevelSkip)
+	cc := dial(t, newTestInterceptor(level.LevelLogger{Logger: genelog.New(io.Discard)}),
+		newTestInterceptor(logger).WithPayload(64, nil))
+
+	ctx := context.Background()
+	for _, s := range []string{"a", "b"} {
+		if err := cc.Invoke(ctx, "/test.Echo/Echo", wrapperspb.String(s), &wrapperspb.StringValue{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream, err := cc.NewStream(ctx, streamDesc, "/test.Echo/Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(wrapperspb.String("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&wrapperspb.StringValue{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&wrapperspb.StringValue{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("want: EOF, got: %v", err)
+	}
+
+	want := "/test.Echo/Echo OK\n" +
+		"/test.Echo/Echo OK\n" +
+		"/test.Echo/Stream send\n" +
+		"/test.Echo/Stream recv\n" +
+		"/test.Echo/Stream OK\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestInterceptor_payload(t *testing.T) {
+	serverRec, serverLogger := newRecorder()
+	_, clientLogger := newRecorder()
+
+	redactor := redact.New().WithKeys("password")
+	server := newTestInterceptor(serverLogger).WithPayload(64, redactor)
+	cc := dial(t, server, newTestInterceptor(clientLogger))
+
+	in, err := structpb.NewStruct(map[string]interface{}{
+		"user":     "alice",
+		"password": "hunter2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.Invoke(context.Background(), "/test.Echo/Struct", in, &structpb.Struct{}); err != nil {
+		t.Fatal(err)
+	}
+	long := wrapperspb.String(strings.Repeat("a", 100))
+	if err := cc.Invoke(context.Background(), "/test.Echo/Echo", long, &wrapperspb.StringValue{}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := serverRec.Entries().Level(level.INFO)
+	logtest.AssertCount(t, entries, 2)
+
+	call := entries[0].Context.(testContext).Call()
+	want := `{"password":"[REDACTED]","user":"alice"}`
+	if call.Request != want || call.Response != want {
+		t.Fatalf("want: %s, got: %s and %s", want, call.Request, call.Response)
+	}
+
+	call = entries[1].Context.(testContext).Call()
+	want = `"` + strings.Repeat("a", 63) + `...`
+	if call.Request != want {
+		t.Fatalf("want: %s, got: %s", want, call.Request)
+	}
+}
+
+func TestInterceptor_stream(t *testing.T) {
+	serverRec, serverLogger := newRecorder()
+	clientRec, clientLogger := newRecorder()
+	client := newTestInterceptor(clientLogger).WithPayload(64, nil)
+	cc := dial(t, newTestInterceptor(serverLogger), client)
+
+	stream, err := cc.NewStream(context.Background(), streamDesc, "/test.Echo/Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"a", "b", "c"} {
+		if err := stream.SendMsg(wrapperspb.String(s)); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.RecvMsg(&wrapperspb.StringValue{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&wrapperspb.StringValue{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("want: EOF, got: %v", err)
+	}
+
+	// the client logs the end of the stream with io.EOF
+	clientEntries := clientRec.Entries()
+	logtest.AssertCount(t, clientEntries.Level(level.DEBUG), 6)
+	logtest.AssertMessage(t, clientEntries.Level(level.INFO), "^/test.Echo/Stream OK$")
+	call := clientEntries.Level(level.INFO)[0].Context.(testContext).Call()
+	if call.Kind != BidiStream || call.Sent != 3 || call.Received != 3 {
+		t.Fatalf("%+v: wrong client call", call)
+	}
+	if recv := clientEntries.Message("recv$")[0].Context.(testContext).Call(); recv.Response != `"a"` {
+		t.Fatalf("%+v: wrong received payload", recv)
+	}
+
+	// the server logs once the handler returned
+	deadline := libtime.Now().Add(libtime.Second)
+	for len(serverRec.Entries().Level(level.INFO)) == 0 && libtime.Now().Before(deadline) {
+		libtime.Sleep(libtime.Millisecond)
+	}
+	serverEntries := serverRec.Entries()
+	logtest.AssertCount(t, serverEntries.Level(level.DEBUG), 1)
+	logtest.AssertMessage(t, serverEntries.Level(level.INFO), "^/test.Echo/Stream OK$")
+	call = serverEntries.Level(level.INFO)[0].Context.(testContext).Call()
+	if call.Side != Server || call.Sent != 3 || call.Received != 3 {
+		t.Fatalf("%+v: wrong server call", call)
+	}
+}
+
+func TestCodeLevel(t *testing.T) {
+	testSuite := map[codes.Code]level.Level{
+		codes.OK:               level.INFO,
+		codes.Canceled:         level.INFO,
+		codes.NotFound:         level.WARNING,
+		codes.Unauthenticated:  level.WARNING,
+		codes.DeadlineExceeded: level.ERROR,
+		codes.Internal:         level.ERROR,
+		codes.Unavailable:      level.ERROR,
+	}
+
+	for code, want := range testSuite {
+		if got := CodeLevel(code); got != want {
+			t.Fatalf("%s: want: %s, got: %s", code, want, got)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package http provides a net/http middleware logging requests.
+//
+// Each request is logged once completed, with its method, path,
+// status, bytes, latency, remote address, user agent and request
+// ID in the Request field of the context. The level depends on
+// the status: ERROR for 5xx, WARNING for 4xx, INFO otherwise.
+//
+// Handlers get a request-scoped logger, carrying the request
+// field, with FromContext.
+//
+// Example:
+//
+//	type Context struct {
+//		*level.WithLevel
+//		*http.WithRequest
+//	}
+//
+//	newContext := func() interface{} {
+//		return Context{level.NewWithLevel(level.INFO), http.NewWithRequest()}
+//	}
+//
+//	logger := level.NewLevelLogger(os.Stdout).
+//		WithFormatter(http.Combined)
+//
+//	handler := http.New(logger, newContext).Handler(mux)
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	libhttp "net/http"
+	"strconv"
+	"strings"
+	libtime "time"
+
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/seq"
+)
+
+// RequestIDHeader is the default header of the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// Request describes an HTTP request and its response
+type Request struct {
+	ID         string           `json:"id,omitempty"`
+	Method     string           `json:"method"`
+	Path       string           `json:"path"`
+	Proto      string           `json:"proto"`
+	RemoteAddr string           `json:"remote_addr"`
+	UserAgent  string           `json:"user_agent,omitempty"`
+	Referer    string           `json:"referer,omitempty"`
+	User       string           `json:"user,omitempty"`
+	Status     int              `json:"status,omitempty"`
+	Bytes      int64            `json:"bytes,omitempty"`
+	Start      libtime.Time     `json:"start"`
+	Latency    libtime.Duration `json:"latency,omitempty"`
+}
+
+type WithRequest struct {
+	request Request
+}
+
+func NewWithRequest() *WithRequest {
+	return &WithRequest{}
+}
+
+// Copy returns a copy of w, for the contexts
+// copied by the logger for each entry
+func (w *WithRequest) Copy() interface{} {
+	copied := *w
+	return &copied
+}
+
+func (w WithRequest) Request() Request {
+	return w.request
+}
+
+func (w *WithRequest) RequestSet(r Request) {
+	w.request = r
+}
+
+func (w WithRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Request Request `json:"request"`
+	}{
+		Request: w.request,
+	})
+}
+
+// Requester is the interface to access the request field
+type Requester interface {
+	Request() Request
+	RequestSet(Request)
+}
+
+// StatusLevel returns the level of a response status
+func StatusLevel(status int) level.Level {
+	switch {
+	case status >= 500:
+		return level.ERROR
+	case status >= 400:
+		return level.WARNING
+	}
+	return level.INFO
+}
+
+// contextKey is the key of the logger in the request context
+type contextKey struct{}
+
+// FromContext returns the request-scoped logger
+func FromContext(ctx context.Context) (level.LevelLogger, bool) {
+	logger, ok := ctx.Value(contextKey{}).(level.LevelLogger)
+	return logger, ok
+}
+
+// Middleware logs the requests of a handler
+type Middleware struct {
+	logger          level.LevelLogger
+	context         func() interface{}
+	requestIDHeader string
+	now             func() libtime.Time
+}
+
+// New returns a middleware logging to logger.
+//
+// newContext returns a new context for each request, so that
+// concurrent requests don't share the fields. It must implement
+// Requester, and level.Leveler to log the level.
+func New(logger level.LevelLogger, newContext func() interface{}) *Middleware {
+	return &Middleware{
+		logger:          logger,
+		context:         newContext,
+		requestIDHeader: RequestIDHeader,
+		now:             libtime.Now,
+	}
+}
+
+// WithRequestIDHeader changes the header of the request ID
+func (m *Middleware) WithRequestIDHeader(header string) *Middleware {
+	middleware := *m
+	middleware.requestIDHeader = header
+	return &middleware
+}
+
+// Handler wraps next to log its requests
+func (m *Middleware) Handler(next libhttp.Handler) libhttp.Handler {
+	return libhttp.HandlerFunc(func(w libhttp.ResponseWriter, r *libhttp.Request) {
+		start := m.now()
+
+		id := r.Header.Get(m.requestIDHeader)
+		if id == "" {
+			id, _ = seq.NewULID()
+		}
+		w.Header().Set(m.requestIDHeader, id)
+
+		user, _, _ := r.BasicAuth()
+		request := Request{
+			ID:         id,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+			Referer:    r.Referer(),
+			User:       user,
+			Start:      start,
+		}
+
+		context := m.context()
+		requester, ok := context.(Requester)
+		if ok {
+			requester.RequestSet(request)
+		}
+		logger := m.logger.WithContext(context)
+
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(contextWithLogger(r.Context(), logger)))
+
+		if !ok {
+			return
+		}
+
+		request.Status = rw.status
+		if request.Status == 0 {
+			request.Status = libhttp.StatusOK
+		}
+		request.Bytes = rw.bytes
+		request.Latency = m.now().Sub(start)
+		requester.RequestSet(request)
+
+		msg := fmt.Sprintf("%s %s %d", request.Method, request.Path, request.Status)
+		switch StatusLevel(request.Status) {
+		case level.ERROR:
+			logger.Errorln(msg)
+		case level.WARNING:
+			logger.Warningln(msg)
+		default:
+			logger.Infoln(msg)
+		}
+	})
+}
+
+func contextWithLogger(ctx context.Context, logger level.LevelLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// responseWriter records the status and size of the response
+type responseWriter struct {
+	libhttp.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = libhttp.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(libhttp.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(libhttp.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http: response writer not implementing http.Hijacker")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped response writer
+func (w *responseWriter) Unwrap() libhttp.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Combined formats entries with a Requester context
+// in the Apache Combined Log Format
+func Combined(v interface{}, msg string) (string, error) {
+	requester, ok := v.(Requester)
+	if !ok {
+		return "", fmt.Errorf("%T: not implementing the Requester interface", v)
+	}
+	r := requester.Request()
+
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+
+	size := "-"
+	if r.Bytes > 0 {
+		size = strconv.FormatInt(r.Bytes, 10)
+	}
+
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`,
+		orDash(host),
+		orDash(r.User),
+		r.Start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method,
+		r.Path,
+		r.Proto,
+		r.Status,
+		size,
+		orDash(escape(r.Referer)),
+		orDash(escape(r.UserAgent))), nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	libhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	libtime "time"
+
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/logtest"
+)
+
+type exampleContext struct {
+	*level.WithLevel
+	*WithRequest
+}
+
+func newContext() interface{} {
+	return exampleContext{
+		level.NewWithLevel(level.DEBUG),
+		NewWithRequest(),
+	}
+}
+
+func newTestMiddleware(logger level.LevelLogger) *Middleware {
+	middleware := New(logger, newContext)
+
+	now := libtime.Date(2022, 2, 1, 12, 30, 0, 0, libtime.UTC)
+	middleware.now = func() libtime.Time {
+		now = now.Add(10 * libtime.Millisecond)
+		return now
+	}
+	return middleware
+}
+
+func ExampleCombined() {
+	buf := bytes.Buffer{}
+
+	logger := level.NewLevelLogger(&buf).
+		WithFormatter(Combined)
+
+	handler := newTestMiddleware(logger).
+		Handler(libhttp.HandlerFunc(func(w libhttp.ResponseWriter, r *libhttp.Request) {
+			_, _ = io.WriteString(w, "hello")
+		}))
+
+	for _, path := range []string{"/index.html?lang=en", "/about.html"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", "curl/7.0")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	fmt.Print(&buf)
+
+	// Output:
+	// 192.0.2.1 - - [01/Feb/2022:12:30:00 +0000] "GET /index.html?lang=en HTTP/1.1" 200 5 "-" "curl/7.0"
+	// 192.0.2.1 - - [01/Feb/2022:12:30:00 +0000] "GET /about.html HTTP/1.1" 200 5 "-" "curl/7.0"
+}
+
+func TestMiddleware_levels(t *testing.T) {
+	rec := logtest.NewRecorder()
+	logger := level.LevelLogger{Logger: rec.Logger()}.
+		AddHook(level.HookLevelSkip)
+
+	handler := newTestMiddleware(logger).
+		Handler(libhttp.HandlerFunc(func(w libhttp.ResponseWriter, r *libhttp.Request) {
+			logger, ok := FromContext(r.Context())
+			if !ok {
+				t.Fatal("no request logger")
+			}
+			logger.Debug("handling")
+
+			switch r.URL.Path {
+			case "/missing":
+				libhttp.NotFound(w, r)
+			case "/fail":
+				w.WriteHeader(libhttp.StatusInternalServerError)
+			}
+		}))
+
+	for _, path := range []string{"/ok", "/missing", "/fail"} {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("POST", path, nil))
+		if resp.Header().Get(RequestIDHeader) == "" {
+			t.Fatalf("%s: no request ID in response", path)
+		}
+	}
+
+	entries := rec.Entries()
+	logtest.AssertCount(t, entries.Level(level.DEBUG), 3)
+	logtest.AssertMessage(t, entries.Level(level.INFO), "^POST /ok 200$")
+	logtest.AssertMessage(t, entries.Level(level.WARNING), "^POST /missing 404$")
+	logtest.AssertMessage(t, entries.Level(level.ERROR), "^POST /fail 500$")
+
+	access := entries.Level(level.WARNING)[0].Context.(exampleContext).Request()
+	if access.Bytes == 0 || access.Latency != 10*libtime.Millisecond || access.ID == "" {
+		t.Fatalf("%+v: missing request fields", access)
+	}
+
+	// the handler logs carry the request
+	debug := entries.Level(level.DEBUG)[0].Context.(exampleContext).Request()
+	if debug.Method != "POST" {
+		t.Fatalf("%+v: request not set in handler logger", debug)
+	}
+}
+
+func TestStatusLevel(t *testing.T) {
+	testSuite := map[int]level.Level{
+		200: level.INFO,
+		304: level.INFO,
+		404: level.WARNING,
+		429: level.WARNING,
+		500: level.ERROR,
+		503: level.ERROR,
+	}
+
+	for status, want := range testSuite {
+		if got := StatusLevel(status); got != want {
+			t.Fatalf("%d: want: %s, got: %s", status, want, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package genelog
+
+import (
+	"context"
+	"sync"
+)
+
+var registry = struct {
+	mu      sync.Mutex
+	loggers []*Logger
+	// closing is the last closing started by Shutdown
+	closing *closing
+}{}
+
+// closing is the closing of the loggers by a call to Shutdown
+type closing struct {
+	// done is closed when the loggers are closed
+	done chan struct{}
+	// err is the first error, set before done is closed
+	err error
+	// abandoned is set, with the registry lock held, when Shutdown
+	// returns before done is closed: err is then returned by the
+	// next call
+	abandoned bool
+}
+
+// Register adds loggers to the loggers closed by Shutdown
+func Register(loggers ...*Logger) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, logger := range loggers {
+		if !registered(logger) {
+			registry.loggers = append(registry.loggers, logger)
+		}
+	}
+}
+
+// registered returns true if logger is in the registry
+func registered(logger *Logger) bool {
+	for _, l := range registry.loggers {
+		if l == logger {
+			return true
+		}
+	}
+	return false
+}
+
+// Shutdown closes the registered loggers in the registration
+// order, flushing and closing their writers, and empties the
+// registry. It is meant to be called on exit: the closed writers
+// can't be reopened and the loggers must not be used after. Use
+// Sync to flush a logger without closing it.
+//
+// It returns the first error, or the error of ctx if it is done
+// before the loggers are closed. The closing then goes on in the
+// background: the next call to Shutdown waits for it, before
+// closing the loggers registered since, and returns its error.
+func Shutdown(ctx context.Context) error {
+	registry.mu.Lock()
+	loggers := registry.loggers
+	registry.loggers = nil
+	previous := registry.closing
+	c := &closing{done: make(chan struct{})}
+	registry.closing = c
+	registry.mu.Unlock()
+
+	go func() {
+		defer close(c.done)
+		if previous != nil {
+			<-previous.done
+			registry.mu.Lock()
+			if previous.abandoned {
+				c.err = previous.err
+			}
+			registry.mu.Unlock()
+		}
+		for _, logger := range loggers {
+			if err := logger.Close(); err != nil && c.err == nil {
+				c.err = err
+			}
+		}
+	}()
+
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		c.abandoned = true
+		return ctx.Err()
+	}
+}
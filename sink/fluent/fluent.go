@@ -0,0 +1,138 @@
+// Package fluent writes log entries to Fluentd or Fluent Bit
+// using the Forward protocol.
+//
+// Formatter is a genelog.Format encoding an entry into a MessagePack
+// Forward message: the tag is the formatter tag or a context field,
+// the record is made of the context fields and the message.
+//
+// Writer sends the messages as is (Message mode), or batches them
+// per tag in Forward or PackedForward mode, optionally waiting
+// for the server acknowledgment of each chunk.
+//
+// Example:
+//
+//	w, err := fluent.Dial("tcp", "localhost:24224")
+//	...
+//	logger := genelog.New(w.WithMode(fluent.PackedForwardMode)).
+//		WithContext(context).
+//		WithFormatter(fluent.NewFormatter("myapp").Format)
+package fluent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	libtime "time"
+
+	"github.com/6prod/genelog/field/time"
+)
+
+// MessageKey is the record key of the message
+const MessageKey = "message"
+
+// Formatter formats entries into Forward messages
+type Formatter struct {
+	tag      string
+	tagField string
+	now      func() libtime.Time
+}
+
+// NewFormatter returns a formatter tagging entries with tag,
+// typically the logger name
+func NewFormatter(tag string) *Formatter {
+	return &Formatter{
+		tag: tag,
+		now: libtime.Now,
+	}
+}
+
+// WithTagField takes the tag from the context field, the formatter
+// tag being used when the field is missing or not a string
+func (f *Formatter) WithTagField(field string) *Formatter {
+	formatter := *f
+	formatter.tagField = field
+	return &formatter
+}
+
+// Format is a genelog.Format returning
+// the MessagePack array [tag, time, record]
+func (f *Formatter) Format(v interface{}, msg string) (string, error) {
+	record, err := Record(v)
+	if err != nil {
+		return "", err
+	}
+
+	tag := f.tag
+	if s, ok := record[f.tagField].(string); ok && f.tagField != "" && s != "" {
+		tag = s
+	}
+	record[MessageKey] = msg
+
+	t := f.now()
+	if timer, ok := v.(time.Timer); ok && !timer.Time().IsZero() {
+		t = timer.Time()
+	}
+
+	b, err := appendValue(nil, []interface{}{tag, eventTime(t), record})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Record returns the fields of the JSON encoded context.
+// If the context is not encoded into an object, it is returned
+// under the "context" key.
+func Record(v interface{}) (map[string]interface{}, error) {
+	record := make(map[string]interface{})
+	if v == nil {
+		return record, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, nil
+	}
+
+	record["context"] = value
+	return record, nil
+}
+
+// splitMessage returns the tag and the [time, record] entry
+// of a Forward message written by Formatter
+func splitMessage(b []byte) (string, []byte, error) {
+	size, err := skip(b)
+	if err != nil {
+		return "", nil, err
+	}
+	b = b[:size]
+
+	kind, n, headerSize, err := header(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if kind != 'a' || n != 3 {
+		return "", nil, fmt.Errorf("fluent: not a Forward message")
+	}
+
+	tag, rest, err := readStr(b[headerSize:])
+	if err != nil {
+		return "", nil, err
+	}
+
+	entry := appendArrayHeader(make([]byte, 0, len(rest)+1), 2)
+	return tag, append(entry, rest...), nil
+}
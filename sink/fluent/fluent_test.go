@@ -0,0 +1,300 @@
+package fluent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	libtime "time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// decode decodes the msgpack subset written by the package
+// into Go values, EventTime being decoded into time.Time
+func decode(b []byte) (interface{}, []byte, error) {
+	kind, n, size, err := header(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := b[0]
+
+	switch kind {
+	case 's':
+		v := b[size : size+n]
+		if c == 0xc4 || c == 0xc5 || c == 0xc6 {
+			return v, b[size+n:], nil
+		}
+		return string(v), b[size+n:], nil
+	case 'a':
+		values := make([]interface{}, 0, n)
+		b = b[size:]
+		for i := 0; i < n; i++ {
+			var v interface{}
+			if v, b, err = decode(b); err != nil {
+				return nil, nil, err
+			}
+			values = append(values, v)
+		}
+		return values, b, nil
+	case 'm':
+		m := make(map[string]interface{}, n)
+		b = b[size:]
+		for i := 0; i < n; i++ {
+			var k, v interface{}
+			if k, b, err = decode(b); err != nil {
+				return nil, nil, err
+			}
+			if v, b, err = decode(b); err != nil {
+				return nil, nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, b, nil
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), b[1:], nil
+	case c >= 0xe0:
+		return int64(int8(c)), b[1:], nil
+	case c == 0xc0:
+		return nil, b[1:], nil
+	case c == 0xc2, c == 0xc3:
+		return c == 0xc3, b[1:], nil
+	case c == 0xd3:
+		return int64(binary.BigEndian.Uint64(b[1:])), b[9:], nil
+	case c == 0xd7:
+		sec := binary.BigEndian.Uint32(b[2:])
+		nsec := binary.BigEndian.Uint32(b[6:])
+		return libtime.Unix(int64(sec), int64(nsec)).UTC(), b[10:], nil
+	}
+
+	return nil, nil, fmt.Errorf("%x: unsupported", c)
+}
+
+type exampleContext struct {
+	*level.WithLevel
+	Service string `json:"service"`
+	Retries int    `json:"retries"`
+}
+
+func (c exampleContext) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"level":%q,"service":%q,"retries":%d}`, c.Level(), c.Service, c.Retries)), nil
+}
+
+func newTestFormatter(tag string) *Formatter {
+	formatter := NewFormatter(tag)
+	formatter.now = func() libtime.Time {
+		return libtime.Date(2022, 2, 1, 12, 30, 0, 0, libtime.UTC)
+	}
+	return formatter
+}
+
+func ExampleFormatter_Format() {
+	context := exampleContext{
+		WithLevel: level.NewWithLevel(level.INFO),
+		Service:   "api",
+		Retries:   3,
+	}
+
+	out, _ := newTestFormatter("myapp").
+		WithTagField("service").
+		Format(context, "mylog")
+
+	v, _, _ := decode([]byte(out))
+	fmt.Println(v)
+
+	// Output:
+	// [api 2022-02-01 12:30:00 +0000 UTC map[level:unset message:mylog retries:3 service:api]]
+}
+
+// server is a Forward server stand-in
+type server struct {
+	ln       net.Listener
+	messages chan []interface{}
+	ack      bool
+}
+
+func newServer(t *testing.T, ack bool) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &server{
+		ln:       ln,
+		messages: make(chan []interface{}, 16),
+		ack:      ack,
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		b, err := readObject(r)
+		if err != nil {
+			return
+		}
+		v, _, err := decode(b)
+		if err != nil {
+			return
+		}
+		msg := v.([]interface{})
+
+		if s.ack {
+			option := msg[len(msg)-1].(map[string]interface{})
+			resp, _ := appendValue(nil, map[string]interface{}{"ack": option["chunk"]})
+			_, _ = conn.Write(resp)
+		}
+		s.messages <- msg
+	}
+}
+
+func (s *server) next(t *testing.T) []interface{} {
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-libtime.After(libtime.Second):
+		t.Fatal("no message received")
+	}
+	return nil
+}
+
+func TestWriter_MessageMode(t *testing.T) {
+	s := newServer(t, true)
+
+	w, err := Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.WithAck(libtime.Second)
+
+	logger := genelog.New(w).
+		WithContext(map[string]string{"service": "api"}).
+		WithFormatter(newTestFormatter("myapp").Format)
+
+	logger.Println("mylog")
+
+	msg := s.next(t)
+	if len(msg) != 4 || msg[0] != "myapp" {
+		t.Fatalf("%v: want [tag, time, record, option]", msg)
+	}
+	record := msg[2].(map[string]interface{})
+	if record["message"] != "mylog" || record["service"] != "api" {
+		t.Fatalf("%v: unexpected record", record)
+	}
+}
+
+func TestWriter_ForwardModes(t *testing.T) {
+	for _, mode := range []Mode{ForwardMode, PackedForwardMode} {
+		s := newServer(t, false)
+
+		w, err := Dial("tcp", s.ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WithMode(mode).
+			WithBatch(3, libtime.Hour)
+
+		formatter := newTestFormatter("myapp").WithTagField("tag")
+		logger := genelog.New(w).
+			WithFormatter(formatter.Format)
+
+		logger.WithContext(map[string]string{"tag": "a"}).Println("a1")
+		logger.WithContext(map[string]string{"tag": "b"}).Println("b1")
+		logger.WithContext(map[string]string{"tag": "a"}).Println("a2")
+
+		for _, want := range []struct {
+			tag      string
+			messages []string
+		}{
+			{"a", []string{"a1", "a2"}},
+			{"b", []string{"b1"}},
+		} {
+			msg := s.next(t)
+			if len(msg) != 2 || msg[0] != want.tag {
+				t.Fatalf("mode %d: %v: want [%s, entries]", mode, msg, want.tag)
+			}
+
+			var entries []interface{}
+			if mode == PackedForwardMode {
+				for b := msg[1].([]byte); len(b) > 0; {
+					var entry interface{}
+					if entry, b, err = decode(b); err != nil {
+						t.Fatal(err)
+					}
+					entries = append(entries, entry)
+				}
+			} else {
+				entries = msg[1].([]interface{})
+			}
+
+			if len(entries) != len(want.messages) {
+				t.Fatalf("mode %d: %v: want %d entries", mode, entries, len(want.messages))
+			}
+			for i, entry := range entries {
+				record := entry.([]interface{})[1].(map[string]interface{})
+				if record["message"] != want.messages[i] {
+					t.Fatalf("mode %d: want: %s, got: %v", mode, want.messages[i], record["message"])
+				}
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriter_ackTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// accept but never acknowledge
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	w, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.WithAck(10 * libtime.Millisecond)
+
+	out, err := newTestFormatter("myapp").Format(nil, "mylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte(out)); err == nil {
+		t.Fatal("want ack error")
+	}
+}
@@ -0,0 +1,322 @@
+package fluent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// This file implements the subset of MessagePack
+// used by the Forward protocol.
+
+var errMsgpack = errors.New("fluent: invalid msgpack")
+
+// eventTime is the Forward protocol EventTime extension
+type eventTime time.Time
+
+func appendValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case float64:
+		b = append(b, 0xcb)
+		return appendUint64(b, math.Float64bits(v)), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return appendInt(b, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendValue(b, f)
+	case string:
+		return append(appendStrHeader(b, len(v)), v...), nil
+	case []byte:
+		return append(appendBinHeader(b, len(v)), v...), nil
+	case eventTime:
+		t := time.Time(v)
+		b = append(b, 0xd7, 0x00)
+		b = appendUint32(b, uint32(t.Unix()))
+		return appendUint32(b, uint32(t.Nanosecond())), nil
+	case []interface{}:
+		b = appendArrayHeader(b, len(v))
+		for _, e := range v {
+			var err error
+			if b, err = appendValue(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = appendMapHeader(b, len(v))
+		for _, k := range keys {
+			var err error
+			b = append(appendStrHeader(b, len(k)), k...)
+			if b, err = appendValue(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("fluent: %T: unsupported msgpack type", v)
+}
+
+func appendInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(n))
+	}
+	b = append(b, 0xd3)
+	return appendUint64(b, uint64(n))
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+func appendStrHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 31:
+		return append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xda), uint16(n))
+	}
+	return appendUint32(append(b, 0xdb), uint32(n))
+}
+
+func appendBinHeader(b []byte, n int) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xc5), uint16(n))
+	}
+	return appendUint32(append(b, 0xc6), uint32(n))
+}
+
+func appendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xdc), uint16(n))
+	}
+	return appendUint32(append(b, 0xdd), uint32(n))
+}
+
+func appendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xde), uint16(n))
+	}
+	return appendUint32(append(b, 0xdf), uint32(n))
+}
+
+// header returns the kind of the object at the start of b, its
+// length (string/binary size, array/map elements or fixed payload
+// size) and the size of its header
+func header(b []byte) (kind byte, n int, size int, err error) {
+	if len(b) == 0 {
+		return 0, 0, 0, errMsgpack
+	}
+
+	c := b[0]
+	uintAt := func(width int) (int, error) {
+		if len(b) < 1+width {
+			return 0, errMsgpack
+		}
+		switch width {
+		case 1:
+			return int(b[1]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(b[1:])), nil
+		}
+		return int(binary.BigEndian.Uint32(b[1:])), nil
+	}
+
+	switch {
+	case c <= 0x7f, c >= 0xe0, c == 0xc0, c == 0xc2, c == 0xc3:
+		return 'v', 0, 1, nil
+	case c&0xe0 == 0xa0:
+		return 's', int(c & 0x1f), 1, nil
+	case c&0xf0 == 0x90:
+		return 'a', int(c & 0x0f), 1, nil
+	case c&0xf0 == 0x80:
+		return 'm', int(c & 0x0f), 1, nil
+	}
+
+	switch c {
+	case 0xcc, 0xd0:
+		return 'v', 1, 1, nil
+	case 0xcd, 0xd1:
+		return 'v', 2, 1, nil
+	case 0xca, 0xce, 0xd2:
+		return 'v', 4, 1, nil
+	case 0xcb, 0xcf, 0xd3:
+		return 'v', 8, 1, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return 'v', 1 + 1<<(c-0xd4), 1, nil
+	case 0xd9, 0xc4:
+		n, err = uintAt(1)
+		return 's', n, 2, err
+	case 0xda, 0xc5:
+		n, err = uintAt(2)
+		return 's', n, 3, err
+	case 0xdb, 0xc6:
+		n, err = uintAt(4)
+		return 's', n, 5, err
+	case 0xc7:
+		n, err = uintAt(1)
+		return 'v', n + 1, 2, err
+	case 0xc8:
+		n, err = uintAt(2)
+		return 'v', n + 1, 3, err
+	case 0xc9:
+		n, err = uintAt(4)
+		return 'v', n + 1, 5, err
+	case 0xdc:
+		n, err = uintAt(2)
+		return 'a', n, 3, err
+	case 0xdd:
+		n, err = uintAt(4)
+		return 'a', n, 5, err
+	case 0xde:
+		n, err = uintAt(2)
+		return 'm', n, 3, err
+	case 0xdf:
+		n, err = uintAt(4)
+		return 'm', n, 5, err
+	}
+
+	return 0, 0, 0, errMsgpack
+}
+
+// skip returns the size of the object at the start of b
+func skip(b []byte) (int, error) {
+	kind, n, size, err := header(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch kind {
+	case 'a', 'm':
+		if kind == 'm' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			m, err := skip(b[size:])
+			if err != nil {
+				return 0, err
+			}
+			size += m
+		}
+		return size, nil
+	}
+
+	if len(b) < size+n {
+		return 0, errMsgpack
+	}
+	return size + n, nil
+}
+
+// readStr returns the string at the start of b and the remaining bytes
+func readStr(b []byte) (string, []byte, error) {
+	kind, n, size, err := header(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if kind != 's' || len(b) < size+n {
+		return "", nil, errMsgpack
+	}
+	return string(b[size : size+n]), b[size+n:], nil
+}
+
+// readObject reads one object from r
+func readObject(r *bufio.Reader) ([]byte, error) {
+	b := make([]byte, 0, 64)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, c)
+
+		n, err := skip(b)
+		if err == nil {
+			return b[:n], nil
+		}
+		if len(b) > 1<<16 {
+			return nil, errMsgpack
+		}
+	}
+}
+
+// readStrMap decodes a map of strings, other values are ignored
+func readStrMap(b []byte) (map[string]string, error) {
+	kind, n, size, err := header(b)
+	if err != nil {
+		return nil, err
+	}
+	if kind != 'm' {
+		return nil, errMsgpack
+	}
+
+	m := make(map[string]string, n)
+	b = b[size:]
+	for i := 0; i < n; i++ {
+		var k string
+		if k, b, err = readStr(b); err != nil {
+			return nil, err
+		}
+
+		if v, rest, err := readStr(b); err == nil {
+			m[k] = v
+			b = rest
+			continue
+		}
+
+		size, err := skip(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[size:]
+	}
+
+	return m, nil
+}
@@ -0,0 +1,336 @@
+package fluent
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Mode is the Forward protocol event mode
+type Mode int
+
+const (
+	// MessageMode sends each entry as [tag, time, record, option]
+	MessageMode Mode = iota
+	// ForwardMode sends batches as [tag, [[time, record], ...], option]
+	ForwardMode
+	// PackedForwardMode sends batches as [tag, bin, option], bin
+	// being the concatenated MessagePack [time, record] entries
+	PackedForwardMode
+)
+
+// Defaults
+const (
+	DefaultBatchSize  = 100
+	DefaultInterval   = time.Second
+	DefaultAckTimeout = 5 * time.Second
+	dialTimeout       = 5 * time.Second
+)
+
+var ErrAck = errors.New("fluent: chunk not acknowledged")
+
+// Writer writes Forward messages formatted by Formatter to a
+// Fluentd or Fluent Bit server
+type Writer struct {
+	mu         sync.Mutex
+	network    string
+	addr       string
+	conn       net.Conn
+	reader     *bufio.Reader
+	mode       Mode
+	ack        bool
+	ackTimeout time.Duration
+	batchSize  int
+	interval   time.Duration
+	// pending holds the entries per tag in Forward modes
+	pending map[string][][]byte
+	tags    []string
+	count   int
+	start   sync.Once
+	done    chan struct{}
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+// Dial connects to the Forward server at addr
+func Dial(network, addr string) (*Writer, error) {
+	w := &Writer{
+		network:    network,
+		addr:       addr,
+		ackTimeout: DefaultAckTimeout,
+		batchSize:  DefaultBatchSize,
+		interval:   DefaultInterval,
+		pending:    make(map[string][][]byte),
+		tags:       make([]string, 0),
+		done:       make(chan struct{}),
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WithMode changes the event mode
+func (w *Writer) WithMode(mode Mode) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.mode = mode
+	return w
+}
+
+// WithAck requests the acknowledgment of every message or batch,
+// waiting up to timeout for it
+func (w *Writer) WithAck(timeout time.Duration) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ack = true
+	w.ackTimeout = timeout
+	return w
+}
+
+// WithBatch changes the maximum number of entries of a batch and
+// the maximum time an entry waits before being sent in Forward modes
+func (w *Writer) WithBatch(size int, interval time.Duration) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batchSize = size
+	w.interval = interval
+	return w
+}
+
+func (w *Writer) connect() error {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	conn, err := net.DialTimeout(w.network, w.addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	w.reader = bufio.NewReader(conn)
+
+	return nil
+}
+
+// Write sends or batches the Forward message p.
+// The trailing newline added by Println is ignored.
+func (w *Writer) Write(p []byte) (int, error) {
+	tag, entry, err := splitMessage(p)
+	if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, net.ErrClosed
+	}
+
+	if w.mode == MessageMode {
+		if err := w.send(tag, entry); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	w.start.Do(w.run)
+
+	if _, ok := w.pending[tag]; !ok {
+		w.tags = append(w.tags, tag)
+	}
+	w.pending[tag] = append(w.pending[tag], entry)
+	w.count++
+
+	if w.count >= w.batchSize {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush sends the batched entries
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	var errs []error
+	for _, tag := range w.tags {
+		if err := w.sendBatch(tag, w.pending[tag]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	w.pending = make(map[string][][]byte)
+	w.tags = w.tags[:0]
+	w.count = 0
+
+	if len(errs) > 0 {
+		return fmt.Errorf("fluent: %d batches lost, first error: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// run flushes the batches at every interval
+func (w *Writer) run() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = w.Flush()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// send sends one entry in Message mode
+func (w *Writer) send(tag string, entry []byte) error {
+	// entry is [time, record], the message is [tag, time, record, option]
+	_, _, size, err := header(entry)
+	if err != nil {
+		return err
+	}
+
+	return w.write(func(option []byte) []byte {
+		n := 3
+		if option != nil {
+			n = 4
+		}
+		b := appendArrayHeader(nil, n)
+		b = append(appendStrHeader(b, len(tag)), tag...)
+		b = append(b, entry[size:]...)
+		return append(b, option...)
+	})
+}
+
+// sendBatch sends the entries of a tag in Forward or PackedForward mode
+func (w *Writer) sendBatch(tag string, entries [][]byte) error {
+	return w.write(func(option []byte) []byte {
+		n := 2
+		if option != nil {
+			n = 3
+		}
+		b := appendArrayHeader(nil, n)
+		b = append(appendStrHeader(b, len(tag)), tag...)
+
+		if w.mode == PackedForwardMode {
+			var size int
+			for _, entry := range entries {
+				size += len(entry)
+			}
+			b = appendBinHeader(b, size)
+		} else {
+			b = appendArrayHeader(b, len(entries))
+		}
+		for _, entry := range entries {
+			b = append(b, entry...)
+		}
+
+		return append(b, option...)
+	})
+}
+
+// write sends the message built by build, with the chunk
+// option if acknowledgments are enabled. The message is sent
+// again once on a new connection if it fails.
+func (w *Writer) write(build func(option []byte) []byte) error {
+	var chunk string
+	var option []byte
+	if w.ack {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+
+		var err error
+		if option, err = appendValue(nil, map[string]interface{}{"chunk": chunk}); err != nil {
+			return err
+		}
+	}
+	msg := build(option)
+
+	err := w.writeMessage(msg, chunk)
+	if err != nil {
+		if err = w.connect(); err == nil {
+			err = w.writeMessage(msg, chunk)
+		}
+	}
+	return err
+}
+
+func (w *Writer) writeMessage(msg []byte, chunk string) error {
+	if w.conn == nil {
+		return net.ErrClosed
+	}
+
+	if _, err := w.conn.Write(msg); err != nil {
+		return err
+	}
+
+	if chunk == "" {
+		return nil
+	}
+
+	_ = w.conn.SetReadDeadline(time.Now().Add(w.ackTimeout))
+	defer func() { _ = w.conn.SetReadDeadline(time.Time{}) }()
+
+	resp, err := readObject(w.reader)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAck, err)
+	}
+	m, err := readStrMap(resp)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAck, err)
+	}
+	if m["ack"] != chunk {
+		return fmt.Errorf("%w: got ack %q", ErrAck, m["ack"])
+	}
+
+	return nil
+}
+
+// Close sends the batched entries and closes the connection
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	err := w.flush()
+	if w.conn != nil {
+		if cerr := w.conn.Close(); err == nil {
+			err = cerr
+		}
+		w.conn = nil
+	}
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	return err
+}
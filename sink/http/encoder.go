@@ -0,0 +1,204 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	libjson "github.com/6prod/genelog/format/json"
+)
+
+// Entry is a log line waiting to be shipped
+type Entry struct {
+	// Time is the time of the write
+	Time time.Time
+	// Line is the formatted entry, without trailing newline
+	Line []byte
+}
+
+// Encoder encodes a batch of entries into a request body
+type Encoder interface {
+	// ContentType is the content type of the body
+	ContentType() string
+	// Encode returns the body of entries
+	Encode(entries []Entry) ([]byte, error)
+}
+
+// line is the structure of lines formatted with format/json
+type line struct {
+	Context json.RawMessage `json:"context"`
+}
+
+// contextFields returns the context fields of a line formatted
+// with format/json, nil if the line is not in that format
+func contextFields(b []byte) map[string]string {
+	var l line
+	if err := json.Unmarshal(b, &l); err != nil || len(l.Context) == 0 {
+		return nil
+	}
+	fields, err := libjson.Fields(l.Context)
+	if err != nil {
+		return nil
+	}
+	return fields
+}
+
+// Loki encodes entries for the Loki push API.
+//
+// Lines are grouped into streams labeled with the static Labels
+// and the selected context Fields of lines formatted with
+// format/json. The time of an entry is its "time" context field
+// if any, the time of the write otherwise.
+type Loki struct {
+	Labels map[string]string
+	Fields []string
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (e Loki) ContentType() string {
+	return "application/json"
+}
+
+func (e Loki) Encode(entries []Entry) ([]byte, error) {
+	streams := make(map[string]*lokiStream)
+	keys := make([]string, 0)
+
+	for _, entry := range entries {
+		labels := make(map[string]string, len(e.Labels)+len(e.Fields))
+		for k, v := range e.Labels {
+			labels[k] = v
+		}
+
+		t := entry.Time
+		fields := contextFields(entry.Line)
+		for _, f := range e.Fields {
+			if v, ok := fields[f]; ok {
+				labels[f] = v
+			}
+		}
+		if v, ok := fields["time"]; ok {
+			if ft, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				t = ft
+			}
+		}
+
+		key := labelsKey(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels, Values: make([][2]string, 0)}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(t.UnixNano(), 10),
+			string(entry.Line),
+		})
+	}
+
+	push := lokiPush{Streams: make([]lokiStream, 0, len(keys))}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, *streams[key])
+	}
+
+	return json.Marshal(push)
+}
+
+// labelsKey returns a string identifying a label set
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := strings.Builder{}
+	for _, k := range keys {
+		b.WriteString(strconv.Quote(k))
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(labels[k]))
+		b.WriteString(",")
+	}
+	return b.String()
+}
+
+// Bulk encodes entries for the Elasticsearch and OpenSearch
+// _bulk API, indexing each line into Index.
+//
+// Lines must be JSON objects, other lines are indexed as
+// {"message": line}.
+type Bulk struct {
+	Index string
+}
+
+func (e Bulk) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (e Bulk) Encode(entries []Entry) ([]byte, error) {
+	action, err := json.Marshal(map[string]map[string]string{
+		"index": {"_index": e.Index},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	for _, entry := range entries {
+		doc, err := document(entry.Line)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(doc)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// document returns b if it is a JSON object,
+// b wrapped in {"message": b} otherwise
+func document(b []byte) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err == nil {
+		return b, nil
+	}
+	return json.Marshal(map[string]string{"message": string(b)})
+}
+
+// JSONArray encodes entries into a JSON array.
+//
+// JSON lines are kept as is, other lines are encoded as strings.
+type JSONArray struct{}
+
+func (e JSONArray) ContentType() string {
+	return "application/json"
+}
+
+func (e JSONArray) Encode(entries []Entry) ([]byte, error) {
+	values := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		if json.Valid(entry.Line) {
+			values = append(values, entry.Line)
+			continue
+		}
+		s, err := json.Marshal(string(entry.Line))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+	return json.Marshal(values)
+}
@@ -0,0 +1,417 @@
+// Package http ships log entries in batches to HTTP endpoints such
+// as Loki, Elasticsearch/OpenSearch _bulk or any JSON endpoint.
+//
+// Sink is an io.WriteCloser: each write is an entry. Entries are
+// sent when a batch is full or after a time interval, compressed
+// with gzip if enabled, and retried with an exponential backoff on
+// 5xx and 429 responses and network errors.
+//
+// The encoders reading context fields, such as the Loki labels,
+// expect lines formatted with format/json.
+//
+// Example:
+//
+//	sink := http.New("http://loki:3100/loki/api/v1/push", http.Loki{
+//		Labels: map[string]string{"app": "myapp"},
+//		Fields: []string{"level"},
+//	})
+//	defer sink.Close()
+//
+//	logger := genelog.New(sink).
+//		WithContext(context).
+//		WithFormatter(json.JSON)
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	libhttp "net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults
+const (
+	DefaultBatchSize  = 1000
+	DefaultBatchBytes = 1 << 20
+	DefaultInterval   = time.Second
+	DefaultRetries    = 5
+	DefaultBackoffMin = 100 * time.Millisecond
+	DefaultBackoffMax = 10 * time.Second
+	// DefaultQueueSize is the number of batches
+	// waiting to be sent before dropping
+	DefaultQueueSize = 16
+)
+
+var ErrClosed = errors.New("http: sink closed")
+
+// StatusError is returned for unexpected response status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("http: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Sink batches entries and sends them to an HTTP endpoint
+type Sink struct {
+	mu         sync.Mutex
+	url        string
+	encoder    Encoder
+	client     *libhttp.Client
+	header     libhttp.Header
+	gzip       bool
+	batchSize  int
+	batchBytes int
+	interval   time.Duration
+	retries    int
+	backoffMin time.Duration
+	backoffMax time.Duration
+	onError    func(error)
+
+	// batch is the batch being filled
+	batch    []Entry
+	batchLen int
+	queue    chan []Entry
+	start    sync.Once
+	done     chan struct{}
+	wg       sync.WaitGroup
+	closed   bool
+	sent     uint64
+	dropped  uint64
+	now      func() time.Time
+	sleep    func(time.Duration)
+
+	// queued and handled count the batches queued and the ones
+	// sent or dropped by the sender, signaled by handledCond
+	queued      uint64
+	handled     uint64
+	handledCond *sync.Cond
+}
+
+// New returns a sink posting batches to url encoded with encoder.
+//
+// The sink starts shipping on the first write.
+func New(url string, encoder Encoder) *Sink {
+	s := &Sink{
+		url:        url,
+		encoder:    encoder,
+		client:     libhttp.DefaultClient,
+		header:     make(libhttp.Header),
+		batchSize:  DefaultBatchSize,
+		batchBytes: DefaultBatchBytes,
+		interval:   DefaultInterval,
+		retries:    DefaultRetries,
+		backoffMin: DefaultBackoffMin,
+		backoffMax: DefaultBackoffMax,
+		batch:      make([]Entry, 0),
+		queue:      make(chan []Entry, DefaultQueueSize),
+		done:       make(chan struct{}),
+		now:        time.Now,
+		sleep:      time.Sleep,
+	}
+	s.handledCond = sync.NewCond(&s.mu)
+	return s
+}
+
+// WithClient changes the HTTP client
+func (s *Sink) WithClient(client *libhttp.Client) *Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = client
+	return s
+}
+
+// WithHeader adds a header to the requests,
+// for authentication or tenant selection
+func (s *Sink) WithHeader(key, value string) *Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header.Add(key, value)
+	return s
+}
+
+// WithGzip enables gzip compression of the request bodies
+func (s *Sink) WithGzip() *Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gzip = true
+	return s
+}
+
+// WithBatch changes the maximum number of entries and bytes of a
+// batch, and the maximum time an entry waits before being sent
+func (s *Sink) WithBatch(size, bytes int, interval time.Duration) *Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchSize = size
+	s.batchBytes = bytes
+	s.interval = interval
+	return s
+}
+
+// WithRetry changes the number of retries of a batch
+// and the delays between them, doubling from min up to max
+func (s *Sink) WithRetry(retries int, min, max time.Duration) *Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries = retries
+	s.backoffMin = min
+	s.backoffMax = max
+	return s
+}
+
+// WithErrorHandler sets a function called with the
+// errors of batches that couldn't be sent
+func (s *Sink) WithErrorHandler(fn func(error)) *Sink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = fn
+	return s
+}
+
+// Sent returns the number of entries sent
+func (s *Sink) Sent() uint64 {
+	return atomic.LoadUint64(&s.sent)
+}
+
+// Dropped returns the number of entries dropped, because the
+// queue was full or the endpoint kept failing
+func (s *Sink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Write adds p, without its trailing newline, to the batch
+func (s *Sink) Write(p []byte) (int, error) {
+	s.start.Do(s.run)
+
+	line := bytes.TrimSuffix(p, []byte("\n"))
+	entry := Entry{
+		Time: s.now(),
+		Line: append(make([]byte, 0, len(line)), line...),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+
+	s.batch = append(s.batch, entry)
+	s.batchLen += len(entry.Line)
+
+	if len(s.batch) >= s.batchSize || s.batchLen >= s.batchBytes {
+		s.enqueue()
+	}
+
+	return len(p), nil
+}
+
+// Flush queues the current batch, without waiting for it to be sent
+func (s *Sink) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.enqueue()
+}
+
+// Sync queues the current batch and waits for the queued batches to
+// be sent, or dropped after their retries, the errors being passed
+// to the error handler
+func (s *Sink) Sync() error {
+	s.start.Do(s.run)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+
+	s.enqueue()
+	for queued := s.queued; s.handled < queued; {
+		s.handledCond.Wait()
+	}
+	return nil
+}
+
+// enqueue queues the batch to the sender, dropping it if the queue is full
+func (s *Sink) enqueue() {
+	if len(s.batch) == 0 {
+		return
+	}
+
+	select {
+	case s.queue <- s.batch:
+		s.queued++
+	default:
+		atomic.AddUint64(&s.dropped, uint64(len(s.batch)))
+	}
+
+	s.batch = make([]Entry, 0, len(s.batch))
+	s.batchLen = 0
+}
+
+// run starts the sender and the interval flusher
+func (s *Sink) run() {
+	s.wg.Add(2)
+
+	go func() {
+		defer s.wg.Done()
+		for batch := range s.queue {
+			if err := s.send(batch); err != nil {
+				atomic.AddUint64(&s.dropped, uint64(len(batch)))
+				s.mu.Lock()
+				onError := s.onError
+				s.mu.Unlock()
+				if onError != nil {
+					onError(err)
+				}
+			} else {
+				atomic.AddUint64(&s.sent, uint64(len(batch)))
+			}
+
+			s.mu.Lock()
+			s.handled++
+			s.handledCond.Broadcast()
+			s.mu.Unlock()
+		}
+	}()
+
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Flush()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// send posts the batch, retrying on temporary failures
+func (s *Sink) send(batch []Entry) error {
+	body, err := s.encoder.Encode(batch)
+	if err != nil {
+		return err
+	}
+
+	if s.gzip {
+		buf := bytes.Buffer{}
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	delay := s.backoffMin
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= s.retries || !retryable(err) {
+			return err
+		}
+
+		wait := delay
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		s.sleep(wait)
+
+		if delay *= 2; delay > s.backoffMax {
+			delay = s.backoffMax
+		}
+	}
+}
+
+// post sends body once. Returns the Retry-After delay if any.
+func (s *Sink) post(body []byte) (time.Duration, error) {
+	req, err := libhttp.NewRequest(libhttp.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	for k, values := range s.header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", s.encoder.ContentType())
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return retryAfter, StatusError{StatusCode: resp.StatusCode, Body: string(msg)}
+}
+
+// retryable returns true for network errors, 5xx and 429 responses
+func retryable(err error) bool {
+	var statusErr StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.StatusCode >= 500 || statusErr.StatusCode == libhttp.StatusTooManyRequests
+}
+
+// Close sends the pending entries and stops the sink
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	batch := s.batch
+	s.batch = nil
+	s.mu.Unlock()
+
+	// the goroutines are started to send the last batch
+	// even if nothing was written
+	s.start.Do(s.run)
+
+	close(s.done)
+	if len(batch) > 0 {
+		s.queue <- batch
+	}
+	close(s.queue)
+	s.wg.Wait()
+
+	return nil
+}
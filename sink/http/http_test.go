@@ -0,0 +1,236 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	libhttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	libjson "github.com/6prod/genelog/format/json"
+)
+
+// server records the request bodies
+type server struct {
+	mu       sync.Mutex
+	bodies   []string
+	statuses []int
+	requests int
+}
+
+func (s *server) ServeHTTP(w libhttp.ResponseWriter, r *libhttp.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(libhttp.StatusBadRequest)
+			return
+		}
+		reader = zr
+	}
+	body, _ := io.ReadAll(reader)
+
+	status := libhttp.StatusOK
+	if s.requests < len(s.statuses) {
+		status = s.statuses[s.requests]
+	}
+	s.requests++
+
+	if status == libhttp.StatusOK {
+		s.bodies = append(s.bodies, string(body))
+	}
+	w.WriteHeader(status)
+}
+
+type exampleContext struct {
+	Level string `json:"level"`
+	Time  string `json:"time"`
+}
+
+func ExampleSink() {
+	recorder := &server{}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	sink := New(ts.URL, Loki{
+		Labels: map[string]string{"app": "myapp"},
+		Fields: []string{"level"},
+	})
+
+	logger := genelog.New(sink).
+		WithContext(exampleContext{Level: "info", Time: "2022-02-01T12:30:00Z"}).
+		WithFormatter(libjson.JSON)
+
+	logger.Println("mylog")
+
+	_ = sink.Close()
+
+	fmt.Println(recorder.bodies[0])
+
+	// Output:
+	// {"streams":[{"stream":{"app":"myapp","level":"info"},"values":[["1643718600000000000","{\"context\":{\"level\":\"info\",\"time\":\"2022-02-01T12:30:00Z\"},\"message\":\"mylog\"}"]]}]}
+}
+
+func TestSink_batchSize(t *testing.T) {
+	recorder := &server{}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	sink := New(ts.URL, JSONArray{}).
+		WithBatch(2, DefaultBatchBytes, time.Hour).
+		WithGzip()
+
+	logger := genelog.New(sink)
+	logger.Println(`{"a":1}`)
+	logger.Println("text")
+	logger.Println("last")
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`[{"a":1},"text"]`, `["last"]`}
+	if len(recorder.bodies) != len(want) {
+		t.Fatalf("want: %v, got: %v", want, recorder.bodies)
+	}
+	for i := range want {
+		if recorder.bodies[i] != want[i] {
+			t.Fatalf("want: %s, got: %s", want[i], recorder.bodies[i])
+		}
+	}
+
+	if got := sink.Sent(); got != 3 {
+		t.Fatalf("sent: want: 3, got: %d", got)
+	}
+
+	if _, err := io.WriteString(sink, "closed"); err != ErrClosed {
+		t.Fatalf("want: %s, got: %v", ErrClosed, err)
+	}
+}
+
+func TestSink_interval(t *testing.T) {
+	recorder := &server{}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	sink := New(ts.URL, JSONArray{}).
+		WithBatch(100, DefaultBatchBytes, 10*time.Millisecond)
+	defer sink.Close()
+
+	_, _ = io.WriteString(sink, "mylog\n")
+
+	deadline := time.Now().Add(time.Second)
+	for sink.Sent() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("batch not sent after interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSink_Sync(t *testing.T) {
+	recorder := &server{}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	sink := New(ts.URL, JSONArray{}).
+		WithBatch(2, DefaultBatchBytes, time.Hour)
+	defer sink.Close()
+
+	logger := genelog.New(sink)
+	for i := 0; i < 5; i++ {
+		logger.Println("mylog")
+	}
+
+	if err := logger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.Sent(); got != 5 {
+		t.Fatalf("want 5 entries sent on sync, got: %d", got)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.bodies) != 3 {
+		t.Fatalf("want 3 batches, got: %q", recorder.bodies)
+	}
+}
+
+func TestSink_retry(t *testing.T) {
+	recorder := &server{
+		statuses: []int{
+			libhttp.StatusServiceUnavailable,
+			libhttp.StatusTooManyRequests,
+			libhttp.StatusOK,
+			libhttp.StatusBadRequest,
+		},
+	}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	var errs []error
+	sink := New(ts.URL, Bulk{Index: "logs"}).
+		WithBatch(1, DefaultBatchBytes, time.Hour).
+		WithRetry(3, time.Millisecond, time.Millisecond).
+		WithErrorHandler(func(err error) { errs = append(errs, err) })
+
+	var sleeps []time.Duration
+	sink.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	_, _ = io.WriteString(sink, `{"message":"a"}`)
+	_, _ = io.WriteString(sink, "b")
+	_ = sink.Close()
+
+	if want := "{\"index\":{\"_index\":\"logs\"}}\n{\"message\":\"a\"}\n"; recorder.bodies[0] != want {
+		t.Fatalf("want: %q, got: %q", want, recorder.bodies[0])
+	}
+	if len(sleeps) != 2 {
+		t.Fatalf("want 2 retries, got: %v", sleeps)
+	}
+
+	// 4xx are not retried
+	if len(errs) != 1 || sink.Dropped() != 1 {
+		t.Fatalf("want 1 dropped entry, got: %d, errors: %v", sink.Dropped(), errs)
+	}
+	if statusErr, ok := errs[0].(StatusError); !ok || statusErr.StatusCode != libhttp.StatusBadRequest {
+		t.Fatalf("%v: want bad request error", errs[0])
+	}
+}
+
+func TestLoki_streams(t *testing.T) {
+	now := time.Unix(10, 0)
+	entries := []Entry{
+		{Time: now, Line: []byte(`{"context":{"level":"info"},"message":"a"}`)},
+		{Time: now, Line: []byte(`{"context":{"level":"error"},"message":"b"}`)},
+		{Time: now, Line: []byte(`{"context":{"level":"info"},"message":"c"}`)},
+	}
+
+	body, err := Loki{Fields: []string{"level"}}.Encode(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var push lokiPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(push.Streams); n != 2 {
+		t.Fatalf("want 2 streams, got: %d", n)
+	}
+	if n := len(push.Streams[0].Values); n != 2 || push.Streams[0].Stream["level"] != "info" {
+		t.Fatalf("%+v: want 2 info values", push.Streams[0])
+	}
+	if !bytes.Contains(body, []byte(`"10000000000"`)) {
+		t.Fatalf("%s: want write time", body)
+	}
+}
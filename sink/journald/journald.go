@@ -0,0 +1,138 @@
+// Package journald writes log entries to systemd-journald
+// using its native protocol.
+//
+// Formatter is a genelog.Format producing the native payload:
+// MESSAGE, PRIORITY from the level of the context, SYSLOG_IDENTIFIER
+// and the context fields as uppercased journal fields.
+//
+// Writer sends each formatted entry as one datagram to the journal
+// socket. Entries too large for a datagram are passed in a sealed
+// memory file descriptor.
+//
+// Example:
+//
+//	w, err := journald.Dial("")
+//	...
+//	logger := genelog.New(w).
+//		WithContext(context).
+//		WithFormatter(journald.NewFormatter("myapp").Format)
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/format/json"
+)
+
+// LevelPriority maps levels to journal priorities,
+// the syslog severities
+var LevelPriority = map[level.Level]int{
+	level.UNSET:   5,
+	level.DEBUG:   7,
+	level.INFO:    6,
+	level.WARNING: 4,
+	level.ERROR:   3,
+	level.FATAL:   2,
+}
+
+// maxFieldName is the maximum length of a journal field name
+const maxFieldName = 64
+
+// Formatter formats entries into journal native payloads
+type Formatter struct {
+	identifier string
+}
+
+// NewFormatter returns a formatter setting SYSLOG_IDENTIFIER
+// to identifier, if not empty
+func NewFormatter(identifier string) *Formatter {
+	return &Formatter{
+		identifier: identifier,
+	}
+}
+
+// Format is a genelog.Format
+func (f *Formatter) Format(v interface{}, msg string) (string, error) {
+	priority := LevelPriority[level.UNSET]
+	if leveler, ok := level.GetLeveler(v); ok {
+		if p, ok := LevelPriority[leveler.Level()]; ok {
+			priority = p
+		}
+	}
+
+	fields, err := json.Fields(v)
+	if err != nil {
+		return "", err
+	}
+
+	buf := bytes.Buffer{}
+	writeField(&buf, "MESSAGE", msg)
+	writeField(&buf, "PRIORITY", strconv.Itoa(priority))
+	if f.identifier != "" {
+		writeField(&buf, "SYSLOG_IDENTIFIER", f.identifier)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := FieldName(k)
+		switch name {
+		case "", "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+			continue
+		}
+		writeField(&buf, name, fields[k])
+	}
+
+	return buf.String(), nil
+}
+
+// writeField writes a field in the native format. Values with
+// newlines are written as binary: the name, a newline, the little
+// endian 64 bits length and the value.
+func writeField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteString("=")
+		buf.WriteString(value)
+		buf.WriteString("\n")
+		return
+	}
+
+	buf.WriteString("\n")
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteString("\n")
+}
+
+// FieldName converts s into a valid journal field name:
+// uppercase letters, digits and underscores, not starting
+// with an underscore or a digit, at most 64 characters.
+//
+// Returns an empty string if nothing is left.
+func FieldName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+
+	// leading underscores are reserved to trusted fields
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > maxFieldName {
+		name = name[:maxFieldName]
+	}
+	return name
+}
@@ -0,0 +1,170 @@
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+type exampleContext struct {
+	*level.WithLevel
+	User string `json:"user"`
+	Path string `json:"http.path"`
+}
+
+func (c exampleContext) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"level":%q,"user":%q,"http.path":%q}`, c.Level(), c.User, c.Path)), nil
+}
+
+func ExampleFormatter_Format() {
+	buf := bytes.Buffer{}
+
+	context := exampleContext{
+		WithLevel: level.NewWithLevel(level.INFO),
+		User:      "bob",
+		Path:      "/index.html",
+	}
+
+	logger := level.NewLevelLogger(&buf).
+		WithContext(context).
+		WithFormatter(NewFormatter("myapp").Format)
+
+	logger.Warning("mylog")
+
+	fmt.Print(&buf)
+
+	// Output:
+	// MESSAGE=mylog
+	// PRIORITY=4
+	// SYSLOG_IDENTIFIER=myapp
+	// HTTP_PATH=/index.html
+	// LEVEL=warning
+	// USER=bob
+}
+
+func TestFormatter_binary(t *testing.T) {
+	got, err := NewFormatter("").Format(nil, "multi\nline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := bytes.Buffer{}
+	want.WriteString("MESSAGE\n")
+	_ = binary.Write(&want, binary.LittleEndian, uint64(10))
+	want.WriteString("multi\nline\nPRIORITY=5\n")
+
+	if got != want.String() {
+		t.Fatalf("want: %q, got: %q", want.String(), got)
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	testSuite := map[string]string{
+		"user":                  "USER",
+		"http.path":             "HTTP_PATH",
+		"_private":              "PRIVATE",
+		"1st":                   "ST",
+		"":                      "",
+		"é":                     "",
+		strings.Repeat("a", 70): strings.Repeat("A", 64),
+	}
+
+	for input, want := range testSuite {
+		if got := FieldName(input); got != want {
+			t.Fatalf("%s: want: %s, got: %s", input, want, got)
+		}
+	}
+}
+
+func listen(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+func TestWriter(t *testing.T) {
+	conn, path := listen(t)
+
+	w, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	genelog.New(w).
+		WithFormatter(NewFormatter("myapp").Format).
+		Println("mylog")
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "MESSAGE=mylog\nPRIORITY=5\nSYSLOG_IDENTIFIER=myapp\n", string(buf[:n]); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestWriter_large(t *testing.T) {
+	conn, path := listen(t)
+
+	w, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	msg := strings.Repeat("a", 1<<20)
+	payload := "MESSAGE=" + msg + "\n"
+	if _, err := io.WriteString(w, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("want empty datagram, got %d bytes", n)
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := os.NewFile(uintptr(fds[0]), "memfd")
+	defer file.Close()
+
+	got := make([]byte, len(payload))
+	if _, err := file.ReadAt(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != payload {
+		t.Fatal("memfd content differs from payload")
+	}
+}
@@ -0,0 +1,54 @@
+package journald
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sendFd writes payload into a sealed memory file
+// and sends its file descriptor to the journal
+func sendFd(conn *net.UnixConn, addr *net.UnixAddr, payload []byte) error {
+	fd, err := unix.MemfdCreate("journal-logging", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return sendTempFile(conn, addr, payload)
+	}
+
+	file := os.NewFile(uintptr(fd), "journal-logging")
+	defer file.Close()
+
+	if _, err := file.Write(payload); err != nil {
+		return err
+	}
+
+	seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		return err
+	}
+
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), addr)
+	return err
+}
+
+// sendTempFile is the fallback of kernels without memfd: payload is
+// written into an unlinked temporary file in /dev/shm
+func sendTempFile(conn *net.UnixConn, addr *net.UnixAddr, payload []byte) error {
+	file, err := os.CreateTemp("/dev/shm", "journal-logging")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return err
+	}
+
+	if _, err := file.Write(payload); err != nil {
+		return err
+	}
+
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), addr)
+	return err
+}
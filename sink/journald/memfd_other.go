@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package journald
+
+import (
+	"errors"
+	"net"
+)
+
+// sendFd is only supported on linux where journald runs
+func sendFd(conn *net.UnixConn, addr *net.UnixAddr, payload []byte) error {
+	return errors.New("journald: entry too large")
+}
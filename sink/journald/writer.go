@@ -0,0 +1,91 @@
+package journald
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// SocketPath is the journal native protocol socket
+const SocketPath = "/run/systemd/journal/socket"
+
+// Writer writes each call to Write as one journal entry.
+//
+// The socket is not connected: each entry is sent to the journal
+// socket path, so that a restart of journald goes unnoticed.
+type Writer struct {
+	mu   sync.Mutex
+	addr *net.UnixAddr
+	conn *net.UnixConn
+}
+
+// Dial opens a socket to the journal at path,
+// SocketPath if empty
+func Dial(path string) (*Writer, error) {
+	if path == "" {
+		path = SocketPath
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	// autobind to an abstract address
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		addr: &net.UnixAddr{Name: path, Net: "unixgram"},
+		conn: conn,
+	}, nil
+}
+
+// Write sends p as one entry.
+//
+// The newline added by Println after the last field is removed.
+func (w *Writer) Write(p []byte) (int, error) {
+	payload := p
+	if bytes.HasSuffix(payload, []byte("\n\n")) {
+		payload = payload[:len(payload)-1]
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return 0, net.ErrClosed
+	}
+
+	_, _, err := w.conn.WriteMsgUnix(payload, nil, w.addr)
+	if isTooLarge(err) {
+		err = sendFd(w.conn, w.addr, payload)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// isTooLarge returns true if the payload doesn't fit in a datagram
+func isTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// Close closes the socket
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
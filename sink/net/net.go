@@ -0,0 +1,335 @@
+// Package net writes log entries to a collector over TCP, UDP
+// or unix sockets.
+//
+// Writer dials lazily on the first write and reconnects with an
+// exponential backoff. While disconnected, entries are buffered
+// up to a bounded size, the oldest ones being dropped first.
+//
+// Reconnection happens on writes: no goroutine runs in the
+// background.
+package net
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	libnet "net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Framing is the way entries are delimited
+type Framing int
+
+const (
+	// Newline terminates each entry with a newline
+	Newline Framing = iota
+	// LengthPrefix prefixes each entry with its length as a
+	// 32 bits big endian integer, the trailing newline removed
+	LengthPrefix
+)
+
+// State is the connection state
+type State int
+
+const (
+	Disconnected State = iota
+	Connected
+	Closed
+)
+
+func (s State) String() string {
+	switch s {
+	case Connected:
+		return "connected"
+	case Closed:
+		return "closed"
+	}
+	return "disconnected"
+}
+
+// Defaults
+const (
+	DefaultBufferSize  = 1 << 20
+	DefaultBackoffMin  = 100 * time.Millisecond
+	DefaultBackoffMax  = 30 * time.Second
+	DefaultDialTimeout = time.Second
+)
+
+var ErrClosed = errors.New("net: writer closed")
+
+// Writer is an io.WriteCloser to a remote collector
+type Writer struct {
+	mu          sync.Mutex
+	network     string
+	addr        string
+	tlsConfig   *tls.Config
+	framing     Framing
+	dialTimeout time.Duration
+	conn        libnet.Conn
+	state       State
+	// buffer holds the framed entries while disconnected
+	buffer     [][]byte
+	bufferLen  int
+	bufferSize int
+	backoffMin time.Duration
+	backoffMax time.Duration
+	// attempts is the number of failed dials since the last connection
+	attempts int
+	// nextDial is the time before which no dial is attempted
+	nextDial time.Time
+	dropped  uint64
+	now      func() time.Time
+	dial     func() (libnet.Conn, error)
+}
+
+// New returns a writer to addr, not connected yet.
+//
+// network is one of the networks of net.Dial.
+func New(network, addr string) *Writer {
+	w := &Writer{
+		network:     network,
+		addr:        addr,
+		dialTimeout: DefaultDialTimeout,
+		buffer:      make([][]byte, 0),
+		bufferSize:  DefaultBufferSize,
+		backoffMin:  DefaultBackoffMin,
+		backoffMax:  DefaultBackoffMax,
+		now:         time.Now,
+	}
+	w.dial = w.dialNet
+	return w
+}
+
+// WithTLS enables TLS on stream connections
+func (w *Writer) WithTLS(config *tls.Config) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tlsConfig = config
+	return w
+}
+
+// WithFraming changes the framing of entries
+func (w *Writer) WithFraming(framing Framing) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.framing = framing
+	return w
+}
+
+// WithBuffer changes the maximum number of bytes buffered
+// while disconnected. 0 disables buffering.
+func (w *Writer) WithBuffer(size int) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.bufferSize = size
+	return w
+}
+
+// WithBackoff changes the delays between dials,
+// doubling from min up to max
+func (w *Writer) WithBackoff(min, max time.Duration) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.backoffMin = min
+	w.backoffMax = max
+	return w
+}
+
+// WithDialTimeout changes the timeout of a dial
+func (w *Writer) WithDialTimeout(timeout time.Duration) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dialTimeout = timeout
+	return w
+}
+
+// State returns the connection state
+func (w *Writer) State() State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state
+}
+
+// Dropped returns the number of entries dropped
+// because the buffer was full
+func (w *Writer) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Write sends p as one entry, or buffers it if the
+// collector can't be reached
+func (w *Writer) Write(p []byte) (int, error) {
+	frame := w.frame(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == Closed {
+		return 0, ErrClosed
+	}
+
+	w.push(frame)
+
+	if w.state == Disconnected && !w.connect() {
+		w.trim()
+		return len(p), nil
+	}
+
+	w.flush()
+
+	return len(p), nil
+}
+
+// frame returns the framed entry
+func (w *Writer) frame(p []byte) []byte {
+	if w.framing == LengthPrefix {
+		if n := len(p); n > 0 && p[n-1] == '\n' {
+			p = p[:n-1]
+		}
+		frame := make([]byte, 4+len(p))
+		binary.BigEndian.PutUint32(frame, uint32(len(p)))
+		copy(frame[4:], p)
+		return frame
+	}
+
+	frame := make([]byte, len(p), len(p)+1)
+	copy(frame, p)
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		frame = append(frame, '\n')
+	}
+	return frame
+}
+
+// push adds frame to the buffer
+func (w *Writer) push(frame []byte) {
+	w.buffer = append(w.buffer, frame)
+	w.bufferLen += len(frame)
+}
+
+// trim drops the oldest entries to keep
+// the buffer under the buffer size
+func (w *Writer) trim() {
+	for w.bufferLen > w.bufferSize && len(w.buffer) > 0 {
+		w.bufferLen -= len(w.buffer[0])
+		w.buffer[0] = nil
+		w.buffer = w.buffer[1:]
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+// flush writes the buffered entries in order.
+// On error, the connection is closed and the
+// remaining entries stay in the buffer.
+//
+// A frame is removed from the buffer once written whole. A frame
+// partly written ends the stream of its connection, closed, and is
+// written again whole on the next one, so that the collector never
+// reads a length prefix followed by another frame.
+func (w *Writer) flush() {
+	for len(w.buffer) > 0 {
+		frame := w.buffer[0]
+		n, err := w.conn.Write(frame)
+		if err == nil && n < len(frame) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			w.disconnect()
+			// retry right away once, the collector may be back
+			if w.connect() {
+				continue
+			}
+			w.trim()
+			return
+		}
+		w.bufferLen -= len(frame)
+		w.buffer[0] = nil
+		w.buffer = w.buffer[1:]
+	}
+}
+
+// connect dials if the backoff delay is over.
+// Returns true if connected.
+func (w *Writer) connect() bool {
+	now := w.now()
+	if now.Before(w.nextDial) {
+		return false
+	}
+
+	conn, err := w.dial()
+	if err != nil {
+		w.attempts++
+		w.nextDial = now.Add(w.backoff())
+		return false
+	}
+
+	w.conn = conn
+	w.state = Connected
+	w.attempts = 0
+	w.nextDial = time.Time{}
+
+	return true
+}
+
+func (w *Writer) dialNet() (libnet.Conn, error) {
+	dialer := &libnet.Dialer{Timeout: w.dialTimeout}
+	if w.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, w.network, w.addr, w.tlsConfig)
+	}
+	return dialer.Dial(w.network, w.addr)
+}
+
+// backoff returns the delay before the next dial
+func (w *Writer) backoff() time.Duration {
+	delay := w.backoffMin
+	for i := 1; i < w.attempts && delay < w.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > w.backoffMax {
+		delay = w.backoffMax
+	}
+	return delay
+}
+
+func (w *Writer) disconnect() {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	w.state = Disconnected
+}
+
+// Close closes the connection. Buffered entries are written if the
+// collector is reachable, dialing once more regardless of the
+// backoff when disconnected, and dropped otherwise.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == Closed {
+		return nil
+	}
+
+	if w.state == Disconnected && len(w.buffer) > 0 {
+		w.nextDial = time.Time{}
+		w.connect()
+	}
+	if w.state == Connected {
+		w.flush()
+	}
+
+	atomic.AddUint64(&w.dropped, uint64(len(w.buffer)))
+	w.buffer = nil
+	w.bufferLen = 0
+
+	var err error
+	if w.conn != nil {
+		err = w.conn.Close()
+		w.conn = nil
+	}
+	w.state = Closed
+
+	return err
+}
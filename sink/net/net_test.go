@@ -0,0 +1,231 @@
+package net
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	libnet "net"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+)
+
+// freeAddr returns a local address with nothing listening
+func freeAddr(t *testing.T) string {
+	ln, err := libnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func accept(t *testing.T, ln libnet.Listener) libnet.Conn {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	return conn
+}
+
+func TestWriter_lazyDial(t *testing.T) {
+	ln, err := libnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	w := New("tcp", ln.Addr().String())
+	defer w.Close()
+
+	if want, got := Disconnected, w.State(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	logger := genelog.New(w)
+	logger.Println("mylog1")
+	logger.Print("mylog2")
+
+	conn := accept(t, ln)
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"mylog1\n", "mylog2\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Fatalf("want: %q, got: %q", want, line)
+		}
+	}
+
+	if want, got := Connected, w.State(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestWriter_backoff(t *testing.T) {
+	addr := freeAddr(t)
+
+	now := time.Date(2022, 2, 1, 12, 30, 0, 0, time.UTC)
+	w := New("tcp", addr).
+		WithBackoff(time.Second, 4*time.Second).
+		WithBuffer(14).
+		WithFraming(LengthPrefix)
+	w.now = func() time.Time { return now }
+	defer w.Close()
+
+	// collector down: entries are buffered, the oldest dropped
+	for _, msg := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		if _, err := io.WriteString(w, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want, got := uint64(2), w.Dropped(); want != got {
+		t.Fatalf("dropped: want: %d, got: %d", want, got)
+	}
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		w.attempts = i + 1
+		if got := w.backoff(); got != want {
+			t.Fatalf("attempt %d: want: %s, got: %s", i+1, want, got)
+		}
+	}
+
+	ln, err := libnet.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	// collector up, backoff not over: "c" dropped
+	w.attempts = 1
+	w.nextDial = now.Add(time.Second)
+	_, _ = io.WriteString(w, "e\n")
+	if want, got := Disconnected, w.State(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	now = now.Add(time.Second)
+	_, _ = io.WriteString(w, "f\n")
+	if want, got := Connected, w.State(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+
+	conn := accept(t, ln)
+	for _, want := range []string{"d", "e", "f"} {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			t.Fatal(err)
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg); got != want {
+			t.Fatalf("want: %q, got: %q", want, got)
+		}
+	}
+}
+
+func TestWriter_Close(t *testing.T) {
+	w := New("tcp", freeAddr(t))
+
+	_, _ = io.WriteString(w, "lost\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := uint64(1), w.Dropped(); want != got {
+		t.Fatalf("dropped: want: %d, got: %d", want, got)
+	}
+
+	if _, err := io.WriteString(w, "closed\n"); err != ErrClosed {
+		t.Fatalf("want: %s, got: %v", ErrClosed, err)
+	}
+	if want, got := Closed, w.State(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestWriter_Close_reconnect(t *testing.T) {
+	addr := freeAddr(t)
+	w := New("tcp", addr).
+		WithBackoff(time.Hour, time.Hour)
+
+	// collector down: the entry is buffered
+	_, _ = io.WriteString(w, "buffered\n")
+
+	ln, err := libnet.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	// collector up, backoff not over: Close dials once more
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped := w.Dropped(); dropped != 0 {
+		t.Fatalf("dropped: %d", dropped)
+	}
+
+	b, err := io.ReadAll(accept(t, ln))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "buffered\n", string(b); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+// shortConn writes at most max bytes, without error
+type shortConn struct {
+	libnet.Conn
+	max     int
+	written []byte
+}
+
+func (c *shortConn) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.max >= 0 && n > c.max {
+		n = c.max
+	}
+	c.written = append(c.written, p[:n]...)
+	return n, nil
+}
+
+func (c *shortConn) Close() error {
+	return nil
+}
+
+func TestWriter_partialWrite(t *testing.T) {
+	broken := &shortConn{max: 3}
+	next := &shortConn{max: -1}
+	conns := []*shortConn{broken, next}
+
+	w := New("tcp", freeAddr(t)).
+		WithFraming(LengthPrefix)
+	w.dial = func() (libnet.Conn, error) {
+		conn := conns[0]
+		conns = conns[1:]
+		return conn, nil
+	}
+	defer w.Close()
+
+	if _, err := io.WriteString(w, "mylog\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the frame cut on the broken connection is written whole on the next one
+	if want, got := "\x00\x00\x00", string(broken.written); want != got {
+		t.Fatalf("broken: want: %q, got: %q", want, got)
+	}
+	if want, got := "\x00\x00\x00\x05mylog", string(next.written); want != got {
+		t.Fatalf("next: want: %q, got: %q", want, got)
+	}
+}
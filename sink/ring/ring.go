@@ -0,0 +1,193 @@
+// Package ring keeps the last log entries in memory, as a flight
+// recorder, and dumps them when an error happens or on request.
+//
+// Ring is an io.Writer storing each write as an entry. It is
+// usually a Tee branch receiving the entries below the level of
+// the real output, the real output dumping the ring when an entry
+// at or above a threshold is logged:
+//
+//	r := ring.New(1000)
+//
+//	logger := level.LevelLogger{Logger: genelog.Tee(
+//		genelog.New(r).
+//			WithFormatter(json.JSON).
+//			AddHook(ring.NewHookBelow(level.INFO)),
+//		genelog.New(os.Stderr).
+//			WithFormatter(json.JSON).
+//			AddHook(level.NewHookLevelMin(level.INFO)).
+//			AddOrderedHook(r.NewHookDump(level.ERROR, os.Stderr)),
+//	)}.
+//		AddHook(level.HookLevelSkip).
+//		WithContext(context)
+package ring
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	libhttp "net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+// record is an entry of the ring
+type record struct {
+	// seq is the position of the entry since the creation
+	// of the ring, starting at 1
+	seq  uint64
+	data []byte
+}
+
+// Ring is a fixed capacity buffer of entries, the oldest
+// entries being overwritten.
+//
+// Writes only use atomic operations.
+type Ring struct {
+	slots []atomic.Value
+	// next is the sequence of the last written entry
+	next uint64
+	// dumped is the sequence of the last dumped entry
+	dumped uint64
+}
+
+// New returns a ring keeping the last capacity entries
+func New(capacity int) *Ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring{
+		slots: make([]atomic.Value, capacity),
+	}
+}
+
+// Write stores a copy of p as one entry
+func (r *Ring) Write(p []byte) (int, error) {
+	data := append(make([]byte, 0, len(p)), p...)
+
+	seq := atomic.AddUint64(&r.next, 1)
+	r.slots[(seq-1)%uint64(len(r.slots))].Store(&record{seq: seq, data: data})
+
+	return len(p), nil
+}
+
+// Len returns the number of entries in the ring
+func (r *Ring) Len() int {
+	n := atomic.LoadUint64(&r.next)
+	if n > uint64(len(r.slots)) {
+		return len(r.slots)
+	}
+	return int(n)
+}
+
+// Entries returns the entries in the written order
+func (r *Ring) Entries() [][]byte {
+	return r.entries(0, atomic.LoadUint64(&r.next))
+}
+
+// entries returns the entries with a sequence in (from, to]
+func (r *Ring) entries(from, to uint64) [][]byte {
+	capacity := uint64(len(r.slots))
+	if to > capacity && to-capacity > from {
+		from = to - capacity
+	}
+
+	entries := make([][]byte, 0, to-from)
+	for seq := from + 1; seq <= to; seq++ {
+		rec, _ := r.slots[(seq-1)%capacity].Load().(*record)
+		// overwritten by a newer entry or not stored yet
+		if rec == nil || rec.seq != seq {
+			continue
+		}
+		entries = append(entries, rec.data)
+	}
+
+	return entries
+}
+
+// DumpTo writes the entries not dumped yet to w
+func (r *Ring) DumpTo(w io.Writer) (int64, error) {
+	to := atomic.LoadUint64(&r.next)
+
+	var from uint64
+	for {
+		from = atomic.LoadUint64(&r.dumped)
+		if from >= to {
+			// nothing new, or a concurrent dump went further
+			return 0, nil
+		}
+		if atomic.CompareAndSwapUint64(&r.dumped, from, to) {
+			break
+		}
+	}
+
+	var written int64
+	for _, entry := range r.entries(from, to) {
+		n, err := w.Write(entry)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// NewHookDump returns a hook dumping the ring to w when an entry
+// has a level at or above threshold, before the entry is written.
+//
+// It must be added with AddOrderedHook to the logger writing to w,
+// so that the dump is written under the write lock of the logger,
+// not interleaved with its entries.
+func (r *Ring) NewHookDump(threshold level.Level, w io.Writer) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := v.(level.Leveler)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Leveler interface", v)
+		}
+		if level.IsActive(threshold, context.Level()) {
+			if _, err := r.DumpTo(w); err != nil {
+				return nil, "", err
+			}
+		}
+		return v, msg, nil
+	}
+}
+
+// ServeHTTP writes the entries of the ring as they were written,
+// the last n ones only with the query parameter n
+func (r *Ring) ServeHTTP(w libhttp.ResponseWriter, req *libhttp.Request) {
+	entries := r.Entries()
+
+	if s := req.URL.Query().Get("n"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			libhttp.Error(w, "invalid n parameter", libhttp.StatusBadRequest)
+			return
+		}
+		if n < len(entries) {
+			entries = entries[len(entries)-n:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(bytes.Join(entries, nil))
+}
+
+// NewHookBelow returns a hook skipping entries at or above max.
+//
+// It keeps in the ring the entries not written to the real output.
+func NewHookBelow(max level.Level) genelog.Hook {
+	return func(v interface{}, msg string) (interface{}, string, error) {
+		context, ok := v.(level.Leveler)
+		if !ok {
+			return nil, "", fmt.Errorf("%T: not implementing the Leveler interface", v)
+		}
+		if level.IsActive(max, context.Level()) {
+			return v, msg, genelog.ErrSkip
+		}
+		return v, msg, nil
+	}
+}
@@ -0,0 +1,202 @@
+package ring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+type exampleWithLevel struct {
+	*level.WithLevel
+}
+
+func ExampleRing_NewHookDump() {
+	output := bytes.Buffer{}
+	r := New(2)
+
+	format := func(v interface{}, msg string) (string, error) {
+		context, _ := v.(exampleWithLevel)
+		return fmt.Sprintf("%s: %s", context.Level(), msg), nil
+	}
+
+	logger := level.LevelLogger{Logger: genelog.Tee(
+		genelog.New(r).
+			WithFormatter(format).
+			AddHook(NewHookBelow(level.INFO)),
+		genelog.New(&output).
+			WithFormatter(format).
+			AddHook(level.NewHookLevelMin(level.INFO)).
+			AddOrderedHook(r.NewHookDump(level.ERROR, &output)),
+	)}.
+		AddHook(level.HookLevelSkip).
+		WithContext(exampleWithLevel{level.NewWithLevel(level.DEBUG)})
+
+	logger.Debugln("step 1")
+	logger.Infoln("started")
+	logger.Debugln("step 2")
+	logger.Debugln("step 3")
+	logger.Errorln("failed")
+	logger.Errorln("failed again")
+
+	fmt.Print(&output)
+
+	// Output:
+	// info: started
+	// debug: step 2
+	// debug: step 3
+	// error: failed
+	// error: failed again
+}
+
+func TestRing_Entries(t *testing.T) {
+	r := New(3)
+
+	if got := len(r.Entries()); got != 0 {
+		t.Fatalf("want empty ring, got %d entries", got)
+	}
+
+	for i := 1; i <= 5; i++ {
+		_, _ = io.WriteString(r, fmt.Sprintf("%d\n", i))
+	}
+
+	if got := string(bytes.Join(r.Entries(), nil)); got != "3\n4\n5\n" {
+		t.Fatalf("want last 3 entries, got: %q", got)
+	}
+	if got := r.Len(); got != 3 {
+		t.Fatalf("len: want: 3, got: %d", got)
+	}
+
+	buf := bytes.Buffer{}
+	if _, err := r.DumpTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(r, "6\n")
+	if _, err := r.DumpTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf.String(); got != "3\n4\n5\n6\n" {
+		t.Fatalf("entries should be dumped once, got: %q", got)
+	}
+}
+
+func TestRing_ServeHTTP(t *testing.T) {
+	r := New(10)
+	for i := 1; i <= 3; i++ {
+		_, _ = io.WriteString(r, fmt.Sprintf("%d\n", i))
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/?n=2", nil))
+
+	if got := rec.Body.String(); got != "2\n3\n" {
+		t.Fatalf("want last 2 entries, got: %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/?n=x", nil))
+	if rec.Code != 400 {
+		t.Fatalf("want bad request, got: %d", rec.Code)
+	}
+}
+
+func TestRing_concurrent(t *testing.T) {
+	r := New(64)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = io.WriteString(r, "entry\n")
+				_ = r.Entries()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(r.Entries()); got != 64 {
+		t.Fatalf("want full ring, got %d entries", got)
+	}
+}
+
+// copierWithLevel is formatted in parallel by the loggers
+type copierWithLevel struct {
+	*level.WithLevel
+}
+
+func (c copierWithLevel) Copy() interface{} {
+	withLevel := *c.WithLevel
+	return copierWithLevel{&withLevel}
+}
+
+// exclusiveWriter fails on concurrent writes
+type exclusiveWriter struct {
+	writing int32
+	n       int32
+}
+
+func (w *exclusiveWriter) Write(p []byte) (int, error) {
+	if !atomic.CompareAndSwapInt32(&w.writing, 0, 1) {
+		return 0, errors.New("concurrent write")
+	}
+	defer atomic.StoreInt32(&w.writing, 0)
+
+	time.Sleep(time.Microsecond)
+	atomic.AddInt32(&w.n, 1)
+	return len(p), nil
+}
+
+func TestRing_NewHookDump_concurrent(t *testing.T) {
+	r := New(1000)
+	output := &exclusiveWriter{}
+
+	var errs int32
+	report := func(res genelog.Result) {
+		if res.Err != nil && !errors.Is(res.Err, genelog.ErrSkip) {
+			atomic.AddInt32(&errs, 1)
+		}
+	}
+
+	logger := level.LevelLogger{Logger: genelog.Tee(
+		genelog.New(r).
+			AddHook(NewHookBelow(level.INFO)),
+		genelog.New(output).
+			AddHook(level.NewHookLevelMin(level.INFO)).
+			AddOrderedHook(r.NewHookDump(level.ERROR, output)).
+			AddObserver(report),
+	)}.
+		AddHook(level.HookLevelSkip)
+
+	const goroutines, entries = 8, 50
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger := logger.WithContext(copierWithLevel{level.NewWithLevel(level.DEBUG)})
+			for j := 0; j < entries; j++ {
+				logger.Debugln("step")
+				logger.Errorln("failed")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errs != 0 {
+		t.Fatalf("%d entries failed", errs)
+	}
+	if want := int32(2 * goroutines * entries); output.n != want {
+		t.Fatalf("want: %d entries, got: %d", want, output.n)
+	}
+}
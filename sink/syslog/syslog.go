@@ -0,0 +1,264 @@
+// Package syslog writes log entries to a syslog daemon.
+//
+// Formatter is a genelog.Format producing RFC 5424 or RFC 3164
+// messages: the severity comes from the level of the context,
+// the timestamp from its time and, with RFC 5424, the context
+// fields are carried as a structured data element.
+//
+// Writer sends each formatted entry as one syslog message over
+// unix datagram or stream sockets, UDP or TCP, reconnecting on
+// failures.
+//
+// Example:
+//
+//	w, err := syslog.Dial("udp", "localhost:514")
+//	...
+//	logger := genelog.New(w).
+//		WithContext(context).
+//		WithFormatter(syslog.NewFormatter(syslog.RFC5424, syslog.LOCAL0, "myapp").Format)
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	libtime "time"
+
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/time"
+	"github.com/6prod/genelog/format/json"
+)
+
+// Protocol is the syslog message format
+type Protocol int
+
+const (
+	// RFC5424 is the IETF syslog format
+	RFC5424 Protocol = iota
+	// RFC3164 is the BSD syslog format
+	RFC3164
+)
+
+// Facility is the syslog facility
+type Facility int
+
+const (
+	KERN Facility = iota
+	USER
+	MAIL
+	DAEMON
+	AUTH
+	SYSLOG
+	LPR
+	NEWS
+	UUCP
+	CRON
+	AUTHPRIV
+	FTP
+	_
+	_
+	_
+	_
+	LOCAL0
+	LOCAL1
+	LOCAL2
+	LOCAL3
+	LOCAL4
+	LOCAL5
+	LOCAL6
+	LOCAL7
+)
+
+// Severity is the syslog severity
+type Severity int
+
+const (
+	EMERG Severity = iota
+	ALERT
+	CRIT
+	ERR
+	WARNING
+	NOTICE
+	INFO
+	DEBUG
+)
+
+// LevelSeverity maps levels to syslog severities
+var LevelSeverity = map[level.Level]Severity{
+	level.UNSET:   NOTICE,
+	level.DEBUG:   DEBUG,
+	level.INFO:    INFO,
+	level.WARNING: WARNING,
+	level.ERROR:   ERR,
+	level.FATAL:   CRIT,
+}
+
+// DefaultSDID is the structured data ID of the context fields,
+// using the enterprise number reserved for documentation
+const DefaultSDID = "genelog@32473"
+
+// nilValue is the RFC 5424 value of empty header fields
+const nilValue = "-"
+
+// Formatter formats entries into syslog messages
+type Formatter struct {
+	protocol Protocol
+	facility Facility
+	hostname string
+	appName  string
+	procID   string
+	msgID    string
+	sdID     string
+	now      func() libtime.Time
+}
+
+// NewFormatter returns a formatter with the hostname and
+// process ID of the running process
+func NewFormatter(protocol Protocol, facility Facility, appName string) *Formatter {
+	hostname, _ := os.Hostname()
+
+	return &Formatter{
+		protocol: protocol,
+		facility: facility,
+		hostname: hostname,
+		appName:  appName,
+		procID:   strconv.Itoa(os.Getpid()),
+		sdID:     DefaultSDID,
+		now:      libtime.Now,
+	}
+}
+
+func (f *Formatter) clone() *Formatter {
+	formatter := *f
+	return &formatter
+}
+
+// WithHostname changes the hostname of the messages
+func (f *Formatter) WithHostname(hostname string) *Formatter {
+	formatter := f.clone()
+	formatter.hostname = hostname
+	return formatter
+}
+
+// WithMsgID sets the RFC 5424 message ID
+func (f *Formatter) WithMsgID(msgID string) *Formatter {
+	formatter := f.clone()
+	formatter.msgID = msgID
+	return formatter
+}
+
+// WithSDID changes the structured data ID of the context fields.
+// An empty ID disables the structured data.
+func (f *Formatter) WithSDID(sdID string) *Formatter {
+	formatter := f.clone()
+	formatter.sdID = sdID
+	return formatter
+}
+
+// Format is a genelog.Format
+func (f *Formatter) Format(v interface{}, msg string) (string, error) {
+	severity := NOTICE
+	if leveler, ok := level.GetLeveler(v); ok {
+		if s, ok := LevelSeverity[leveler.Level()]; ok {
+			severity = s
+		}
+	}
+	pri := int(f.facility)*8 + int(severity)
+
+	t := f.now()
+	if timer, ok := v.(time.Timer); ok && !timer.Time().IsZero() {
+		t = timer.Time()
+	}
+
+	if f.protocol == RFC3164 {
+		return fmt.Sprintf("<%d>%s %s %s[%s]: %s",
+			pri,
+			t.Format(libtime.Stamp),
+			header(f.hostname),
+			header(f.appName),
+			f.procID,
+			msg), nil
+	}
+
+	sd := nilValue
+	if f.sdID != "" {
+		var err error
+		if sd, err = structuredData(f.sdID, v); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		pri,
+		t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		header(f.hostname),
+		header(f.appName),
+		header(f.procID),
+		header(f.msgID),
+		sd,
+		msg), nil
+}
+
+// header returns s as a RFC 5424 header field
+func header(s string) string {
+	if s == "" {
+		return nilValue
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// structuredData returns the context fields as
+// a RFC 5424 structured data element
+func structuredData(sdID string, v interface{}) (string, error) {
+	fields, err := json.Fields(v)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return nilValue, nil
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.Buffer{}
+	buf.WriteString("[")
+	buf.WriteString(sdID)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, ` %s="%s"`, paramName(k), paramValue(fields[k]))
+	}
+	buf.WriteString("]")
+
+	return buf.String(), nil
+}
+
+// paramName sanitizes a SD-PARAM name
+func paramName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r <= ' ' || r > '~', r == '=', r == ']', r == '"':
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+// paramValue escapes a SD-PARAM value
+func paramValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
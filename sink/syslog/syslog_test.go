@@ -0,0 +1,250 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	libtime "time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/level"
+)
+
+type exampleContext struct {
+	*level.WithLevel
+	User string `json:"user"`
+}
+
+func (c exampleContext) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"level":%q,"user":%q}`, c.Level(), c.User)), nil
+}
+
+func newTestFormatter(protocol Protocol) *Formatter {
+	formatter := NewFormatter(protocol, LOCAL0, "myapp").
+		WithHostname("myhost")
+	formatter.procID = "42"
+	formatter.now = func() libtime.Time {
+		return libtime.Date(2022, 2, 1, 12, 30, 0, 0, libtime.UTC)
+	}
+	return formatter
+}
+
+func ExampleFormatter_Format() {
+	buf := bytes.Buffer{}
+
+	context := exampleContext{
+		WithLevel: level.NewWithLevel(level.INFO),
+		User:      `bob "the builder"`,
+	}
+
+	logger := level.NewLevelLogger(&buf).
+		WithContext(context).
+		WithFormatter(newTestFormatter(RFC5424).Format)
+
+	logger.Errorln("mylog")
+
+	fmt.Print(&buf)
+
+	// Output:
+	// <131>1 2022-02-01T12:30:00.000000Z myhost myapp 42 - [genelog@32473 level="error" user="bob \"the builder\""] mylog
+}
+
+func TestFormatter_RFC3164(t *testing.T) {
+	context := exampleContext{
+		WithLevel: level.NewWithLevel(level.INFO),
+	}
+	context.LevelSet(level.WARNING)
+
+	got, err := newTestFormatter(RFC3164).Format(context, "mylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<132>Feb  1 12:30:00 myhost myapp[42]: mylog"; want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestFormatter_noContext(t *testing.T) {
+	got, err := newTestFormatter(RFC5424).WithMsgID("ID1").Format(nil, "mylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<133>1 2022-02-01T12:30:00.000000Z myhost myapp 42 ID1 - mylog"; want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestWriter_unixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := Dial("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	logger := genelog.New(w)
+	logger.Println("mylog1")
+	logger.Println("mylog2")
+
+	for _, want := range []string{"mylog1", "mylog2"} {
+		buf := make([]byte, 1024)
+		_ = conn.SetReadDeadline(libtime.Now().Add(libtime.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Fatalf("want: %q, got: %q", want, got)
+		}
+	}
+}
+
+func TestWriter_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := io.WriteString(w, "mylog\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(libtime.Now().Add(libtime.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "mylog", string(buf[:n]); got != want {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+// readOctetCounting reads a RFC 6587 octet counted message
+func readOctetCounting(r *bufio.Reader) (string, error) {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+func TestWriter_tcpReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	w, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	conn := <-conns
+	if _, err := io.WriteString(w, "multi\nline\n"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readOctetCounting(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "multi\nline"; got != want {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+
+	// the daemon restarts: writes fail until the writer reconnects
+	conn.Close()
+
+	var newConn net.Conn
+	for newConn == nil {
+		_, _ = io.WriteString(w, "after restart\n")
+		select {
+		case newConn = <-conns:
+		case <-libtime.After(10 * libtime.Millisecond):
+		}
+	}
+	defer newConn.Close()
+
+	got, err = readOctetCounting(bufio.NewReader(newConn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "after restart"; got != want {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestWriter_unixStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	defer os.Remove(path)
+
+	w, err := Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	genelog.New(w).Println("mylog")
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "mylog\n"; line != want {
+		t.Fatalf("want: %q, got: %q", want, line)
+	}
+}
@@ -0,0 +1,178 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Framing is the way messages are delimited on stream sockets
+type Framing int
+
+const (
+	// OctetCounting prefixes each message with its length (RFC 6587)
+	OctetCounting Framing = iota
+	// NonTransparent terminates each message with a newline
+	NonTransparent
+)
+
+// dialTimeout limits the time to connect to the daemon
+const dialTimeout = 5 * time.Second
+
+// localPaths are the usual paths of the local syslog socket
+var localPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var ErrNoLocalSyslog = errors.New("syslog: no local syslog socket found")
+
+// Writer writes each call to Write as one syslog message.
+//
+// The trailing newline added by Println is removed. The connection
+// is reopened on write errors, and the message is retried once.
+type Writer struct {
+	mu      sync.Mutex
+	network string
+	addr    string
+	framing Framing
+	conn    net.Conn
+}
+
+// Dial connects to the syslog daemon at addr.
+//
+// network is one of "unixgram", "unix", "udp" or "tcp". If network
+// and addr are empty, Dial connects to the local syslog socket.
+//
+// Messages on "tcp" use octet counting framing, messages on
+// "unix" stream sockets are newline terminated.
+func Dial(network, addr string) (*Writer, error) {
+	w := &Writer{
+		network: network,
+		addr:    addr,
+		framing: OctetCounting,
+	}
+	if network == "unix" {
+		w.framing = NonTransparent
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WithFraming changes the framing on stream sockets
+func (w *Writer) WithFraming(framing Framing) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.framing = framing
+	return w
+}
+
+func (w *Writer) connect() error {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	if w.network == "" && w.addr == "" {
+		return w.connectLocal()
+	}
+
+	conn, err := net.DialTimeout(w.network, w.addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+
+	return nil
+}
+
+func (w *Writer) connectLocal() error {
+	for _, path := range localPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, path, dialTimeout)
+			if err != nil {
+				continue
+			}
+			w.conn = conn
+			if network == "unix" {
+				w.framing = NonTransparent
+			}
+			return nil
+		}
+	}
+	return ErrNoLocalSyslog
+}
+
+// Write sends p as one message
+func (w *Writer) Write(p []byte) (int, error) {
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+	if len(msg) == 0 {
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return len(p), nil
+		}
+	}
+
+	// reconnect and retry once
+	if err := w.connect(); err != nil {
+		return 0, err
+	}
+	if err := w.send(msg); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *Writer) send(msg []byte) error {
+	var frame []byte
+
+	switch {
+	case isDatagram(w.conn):
+		frame = msg
+	case w.framing == NonTransparent:
+		frame = append(append(make([]byte, 0, len(msg)+1), msg...), '\n')
+	default:
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	_, err := w.conn.Write(frame)
+	return err
+}
+
+// isDatagram returns true for connections without framing
+func isDatagram(conn net.Conn) bool {
+	switch c := conn.(type) {
+	case *net.UDPConn:
+		return true
+	case *net.UnixConn:
+		return c.LocalAddr() != nil && c.LocalAddr().Network() == "unixgram" ||
+			c.RemoteAddr() != nil && c.RemoteAddr().Network() == "unixgram"
+	}
+	return false
+}
+
+// Close closes the connection
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
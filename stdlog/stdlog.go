@@ -0,0 +1,250 @@
+// Package stdlog bridges the standard library log package
+// to genelog.
+//
+// New builds a *log.Logger writing through a genelog Logger at a
+// given level. Redirect sends the output of the global log package
+// to a genelog Logger.
+//
+// The date, time and file prefixes written by the log package are
+// parsed: they update the time.Timer and caller.Caller fields of
+// the context, if implemented, instead of staying in the message.
+// They are set in a hook added after the hooks of the logger, so
+// that the parsed values replace those set by hooks such as
+// time.HookUpdateTime and caller.HookCaller.
+//
+// The fields are set on a copy of the context made for each entry:
+// with genelog.Copier if implemented, or else by copying the context
+// struct and its time.Timer and caller.Caller pointer fields.
+package stdlog
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	libtime "time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/caller"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/time"
+)
+
+// New returns a standard logger writing each line to logger at
+// level l, without prefix nor flags. They must not be changed, the
+// lines being parsed without them.
+//
+// With level.UNSET, or if the context does not implement
+// level.Leveler, lines are written without changing the level.
+func New(logger *genelog.Logger, l level.Level) *log.Logger {
+	return log.New(NewWriter(logger, l, "", 0), "", 0)
+}
+
+// Redirect sends the output of the global log package to logger
+// at level l and returns a function restoring the previous output,
+// prefix and flags.
+//
+// The log prefix and flags are kept and parsed. They are read once:
+// call Redirect again after changing them.
+func Redirect(logger *genelog.Logger, l level.Level) func() {
+	previous := log.Writer()
+	prefix := log.Prefix()
+	flags := log.Flags()
+
+	log.SetOutput(NewWriter(logger, l, prefix, flags))
+
+	return func() {
+		log.SetOutput(previous)
+		log.SetPrefix(prefix)
+		log.SetFlags(flags)
+	}
+}
+
+// Writer parses the lines of a standard logger
+// and writes them to a genelog Logger
+type Writer struct {
+	logger *genelog.Logger
+	level  level.Level
+	prefix string
+	flags  int
+}
+
+// NewWriter returns a writer parsing lines written with prefix and
+// flags, those of the standard logger writing to it.
+//
+// They are not read from the standard logger on each write, as the
+// log package holds its lock while writing before Go 1.21.
+func NewWriter(logger *genelog.Logger, l level.Level, prefix string, flags int) *Writer {
+	return &Writer{
+		logger: logger,
+		level:  l,
+		prefix: prefix,
+		flags:  flags,
+	}
+}
+
+// Write writes each line of p as an entry
+func (w *Writer) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(bytes.TrimSuffix(p, []byte("\n"))), "\n") {
+		w.write(Parse(line, w.prefix, w.flags))
+	}
+
+	return len(p), nil
+}
+
+func (w *Writer) write(entry Entry) {
+	// the fields are set in a last hook, replacing the values set
+	// by the hooks of the logger, run one entry at a time if the
+	// context could not be copied
+	logger := w.logger.
+		WithContext(copyContext(w.logger.Context())).
+		AddHook(func(v interface{}, msg string) (interface{}, string, error) {
+			if timer, ok := v.(time.Timer); ok && !entry.Time.IsZero() {
+				timer.TimeSet(entry.Time)
+			}
+			if c, ok := v.(caller.Caller); ok && entry.File != "" {
+				c.CallerSet(entry.File, entry.Line)
+			}
+			return v, msg, nil
+		})
+
+	if w.level == level.UNSET {
+		logger.Println(entry.Message)
+		return
+	}
+
+	err := level.Output(logger, w.level, func(logger *genelog.Logger) error {
+		logger.Println(entry.Message)
+		return nil
+	})
+	if err != nil {
+		logger.Println(entry.Message)
+	}
+}
+
+// copyContext returns a copy of context for an entry, with Copy if
+// it implements genelog.Copier, or else by copying the struct and
+// its exported time.Timer and caller.Caller pointer fields
+func copyContext(context interface{}) interface{} {
+	if copier, ok := context.(genelog.Copier); ok {
+		return copier.Copy()
+	}
+
+	v := reflect.ValueOf(context)
+	if v.Kind() != reflect.Struct {
+		return context
+	}
+
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	for i := 0; i < copied.NumField(); i++ {
+		field := copied.Field(i)
+		if field.Kind() != reflect.Ptr || field.IsNil() || !field.CanSet() {
+			continue
+		}
+		switch field.Interface().(type) {
+		case time.Timer, caller.Caller:
+			p := reflect.New(field.Type().Elem())
+			p.Elem().Set(field.Elem())
+			field.Set(p)
+		}
+	}
+	return copied.Interface()
+}
+
+// Entry is a parsed line of a standard logger
+type Entry struct {
+	Time    libtime.Time
+	File    string
+	Line    int
+	Message string
+}
+
+// Parse splits a line written by a standard logger with prefix
+// and flags. Parts that can't be parsed are left in the message.
+func Parse(line, prefix string, flags int) Entry {
+	var entry Entry
+
+	if flags&log.Lmsgprefix == 0 {
+		line = strings.TrimPrefix(line, prefix)
+	}
+
+	location := libtime.Local
+	if flags&log.LUTC != 0 {
+		location = libtime.UTC
+	}
+
+	var date, clock string
+	if flags&log.Ldate != 0 {
+		date, line = cut(line, 11)
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		n := 9
+		if flags&log.Lmicroseconds != 0 {
+			n = 16
+		}
+		clock, line = cut(line, n)
+	}
+	entry.Time = parseTime(strings.TrimSpace(date), strings.TrimSpace(clock), location)
+
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		// file.go:23: message
+		if i := strings.Index(line, ": "); i > 0 {
+			location := line[:i]
+			if j := strings.LastIndex(location, ":"); j > 0 {
+				if n, err := strconv.Atoi(location[j+1:]); err == nil {
+					entry.File = location[:j]
+					entry.Line = n
+					line = line[i+2:]
+				}
+			}
+		}
+	}
+
+	if flags&log.Lmsgprefix != 0 {
+		line = strings.TrimPrefix(line, prefix)
+	}
+
+	entry.Message = line
+
+	return entry
+}
+
+// cut returns the first n bytes of s and the rest,
+// or an empty string and s if s is too short
+func cut(s string, n int) (string, string) {
+	if len(s) < n {
+		return "", s
+	}
+	return s[:n], s[n:]
+}
+
+// parseTime returns the time of the date and clock prefixes,
+// the zero time if missing or invalid
+func parseTime(date, clock string, location *libtime.Location) libtime.Time {
+	if date == "" && clock == "" {
+		return libtime.Time{}
+	}
+
+	if date == "" {
+		// the log package writes no date, use today
+		date = libtime.Now().In(location).Format("2006/01/02")
+	}
+
+	layout := "2006/01/02"
+	value := date
+	if clock != "" {
+		layout += " 15:04:05"
+		if strings.Contains(clock, ".") {
+			layout += ".000000"
+		}
+		value += " " + clock
+	}
+
+	t, err := libtime.ParseInLocation(layout, value, location)
+	if err != nil {
+		return libtime.Time{}
+	}
+	return t
+}
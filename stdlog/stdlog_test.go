@@ -0,0 +1,205 @@
+package stdlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	libtime "time"
+
+	"github.com/6prod/genelog"
+	"github.com/6prod/genelog/field/caller"
+	"github.com/6prod/genelog/field/level"
+	"github.com/6prod/genelog/field/time"
+	"github.com/6prod/genelog/format/json"
+)
+
+type exampleWithLevel struct {
+	*level.WithLevel
+}
+
+func ExampleNew() {
+	buf := bytes.Buffer{}
+
+	logger := level.NewLevelLogger(&buf).
+		WithContext(exampleWithLevel{level.NewWithLevel(level.INFO)}).
+		WithFormatter(json.JSON)
+
+	stdlogger := New(logger.Logger, level.WARNING)
+	stdlogger.Printf("legacy %s", "code")
+
+	fmt.Print(&buf)
+
+	// Output:
+	// {"context":{"level":"warning"},"message":"legacy code"}
+}
+
+type exampleContext struct {
+	*level.WithLevel
+	*time.WithTime
+	*caller.WithCaller
+}
+
+type testParseTestCase struct {
+	Description string
+	Line        string
+	Prefix      string
+	Flags       int
+	Want        Entry
+}
+
+var testParseTestSuite = []testParseTestCase{
+	{
+		Description: "no flags",
+		Line:        "mylog",
+		Want:        Entry{Message: "mylog"},
+	},
+	{
+		Description: "standard flags and prefix",
+		Line:        "app: 2022/02/01 12:30:00 mylog",
+		Prefix:      "app: ",
+		Flags:       log.LstdFlags | log.LUTC,
+		Want: Entry{
+			Time:    libtime.Date(2022, 2, 1, 12, 30, 0, 0, libtime.UTC),
+			Message: "mylog",
+		},
+	},
+	{
+		Description: "microseconds, file and message prefix",
+		Line:        "2022/02/01 12:30:00.000123 main.go:23: app: mylog: detail",
+		Prefix:      "app: ",
+		Flags:       log.LstdFlags | log.Lmicroseconds | log.Lshortfile | log.Lmsgprefix | log.LUTC,
+		Want: Entry{
+			Time:    libtime.Date(2022, 2, 1, 12, 30, 0, 123000, libtime.UTC),
+			File:    "main.go",
+			Line:    23,
+			Message: "mylog: detail",
+		},
+	},
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range testParseTestSuite {
+		got := Parse(tc.Line, tc.Prefix, tc.Flags)
+		if !got.Time.Equal(tc.Want.Time) || got.File != tc.Want.File || got.Line != tc.Want.Line || got.Message != tc.Want.Message {
+			t.Fatalf("%s: want: %+v, got: %+v", tc.Description, tc.Want, got)
+		}
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	context := exampleContext{
+		level.NewWithLevel(level.INFO),
+		time.NewWithTime(libtime.Time{}),
+		caller.NewWithCaller(),
+	}
+
+	logger := level.NewLevelLogger(&buf).
+		WithContext(context).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			context, _ := v.(exampleContext)
+			file, line := context.Caller()
+			return fmt.Sprintf("%s %s %s:%d %s",
+				context.Level(),
+				context.Time().Format(libtime.RFC3339),
+				file, line, msg), nil
+		})
+
+	previous := bytes.Buffer{}
+	log.SetOutput(&previous)
+	defer log.SetOutput(os.Stderr)
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+	log.SetPrefix("legacy: ")
+	defer log.SetPrefix("")
+	defer log.SetFlags(log.LstdFlags)
+	restore := Redirect(logger.Logger, level.ERROR)
+
+	before := libtime.Now().UTC().Truncate(libtime.Second)
+	_, _, line, _ := runtime.Caller(0)
+	log.Println("mylog")
+
+	restore()
+	log.Println("restored")
+
+	if !bytes.HasSuffix(previous.Bytes(), []byte("restored\n")) {
+		t.Fatalf("%s: previous output not restored", previous.String())
+	}
+
+	var lvl, date, location, msg string
+	if _, err := fmt.Sscan(buf.String(), &lvl, &date, &location, &msg); err != nil {
+		t.Fatalf("%s: %s", buf.String(), err)
+	}
+
+	if lvl != "error" || location != fmt.Sprintf("stdlog_test.go:%d", line+1) || msg != "mylog" {
+		t.Fatalf("unexpected entry: %s", buf.String())
+	}
+
+	got, err := libtime.Parse(libtime.RFC3339, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Before(before) {
+		t.Fatalf("%s: time not parsed", date)
+	}
+}
+
+func TestNew_context(t *testing.T) {
+	context := exampleContext{
+		level.NewWithLevel(level.INFO),
+		time.NewWithTime(libtime.Time{}),
+		caller.NewWithCaller(),
+	}
+	logger := genelog.New(io.Discard).WithContext(context)
+
+	stdlogger := log.New(NewWriter(logger, level.WARNING, "", log.LstdFlags|log.Lshortfile), "", log.LstdFlags|log.Lshortfile)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stdlogger.Println("mylog")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the time and caller are set on copies of the context
+	if file, _ := context.Caller(); file != "" || !context.Time().IsZero() {
+		t.Fatalf("context updated: %s %s", file, context.Time())
+	}
+}
+
+func TestNew_hooks(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger := genelog.New(&buf).
+		WithContext(exampleContext{
+			level.NewWithLevel(level.INFO),
+			time.NewWithTime(libtime.Time{}),
+			caller.NewWithCaller(),
+		}).
+		WithFormatter(func(v interface{}, msg string) (string, error) {
+			context := v.(exampleContext)
+			file, line := context.Caller()
+			return fmt.Sprintf("%s %s:%d %s", context.Time().Format(libtime.RFC3339), file, line, msg), nil
+		}).
+		AddHook(time.HookUpdateTime).
+		AddHook(caller.HookCaller)
+
+	flags := log.LstdFlags | log.Lshortfile | log.LUTC
+	_, _ = NewWriter(logger, level.WARNING, "", flags).
+		Write([]byte("2022/02/01 12:30:00 main.go:23: mylog\n"))
+
+	// the parsed values replace those of the hooks
+	if want, got := "2022-02-01T12:30:00Z main.go:23 mylog\n", buf.String(); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}